@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+// stashJSON is the machine-readable form of a stashEntry.
+type stashJSON struct {
+	Index       int       `json:"index"`
+	Ref         string    `json:"ref"`
+	Branch      string    `json:"branch"`
+	Message     string    `json:"message"`
+	SHA         string    `json:"sha"`
+	Date        time.Time `json:"date"`
+	Author      string    `json:"author"`
+	Base        string    `json:"base"`
+	BaseSubject string    `json:"baseSubject"`
+}
+
+// fileJSON is the machine-readable form of a fileEntry.
+type fileJSON struct {
+	Status  string `json:"status"`
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath,omitempty"`
+	Section string `json:"section"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+const cliUsage = `Usage:
+  stash-explorer [-C dir] [-no-syntax]          start the interactive explorer
+  stash-explorer [-C dir] list [-json]          list stashes
+  stash-explorer [-C dir] files [-json] <ref>   list files changed in a stash
+  stash-explorer [-C dir] diff [-section s] <ref> <file>
+                                                print the diff of a file in a stash
+`
+
+// runCommand runs a non-interactive subcommand, writing its output to w.
+func runCommand(args []string, w io.Writer) error {
+	switch args[0] {
+	case "list":
+		return runList(args[1:], w)
+	case "files":
+		return runFiles(args[1:], w)
+	case "diff":
+		return runDiff(args[1:], w)
+	}
+	return fmt.Errorf("unknown command %q\n\n%s", args[0], cliUsage)
+}
+
+func runList(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	stashes, err := loadStashes()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		out := make([]stashJSON, len(stashes))
+		for i, s := range stashes {
+			out[i] = stashJSON{
+				Index:       s.index,
+				Ref:         s.ref,
+				Branch:      s.branch,
+				Message:     s.message,
+				SHA:         s.sha,
+				Date:        s.date,
+				Author:      s.author,
+				Base:        s.base,
+				BaseSubject: s.baseSubject,
+			}
+		}
+		return writeJSON(w, out)
+	}
+	for _, s := range stashes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.ref, s.branch, s.message)
+	}
+	return nil
+}
+
+func runFiles(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("files", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "Print JSON")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 1 {
+		return fmt.Errorf("files: expected a stash ref\n\n%s", cliUsage)
+	}
+
+	files, err := loadFiles(pos[0], diffBase{})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		out := make([]fileJSON, len(files))
+		for i, f := range files {
+			out[i] = fileJSON{
+				Status:  f.status,
+				Path:    f.name,
+				OldPath: f.oldName,
+				Section: f.section.String(),
+				Added:   f.added,
+				Removed: f.removed,
+			}
+		}
+		return writeJSON(w, out)
+	}
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%s\t+%d\t-%d\t%s\n", f.status, f.section, f.added, f.removed, f.label())
+	}
+	return nil
+}
+
+func runDiff(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	section := fs.String("section", "", "Only diff the staged, unstaged or untracked part")
+	pos, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 2 {
+		return fmt.Errorf("diff: expected a stash ref and a file\n\n%s", cliUsage)
+	}
+	ref, name := pos[0], pos[1]
+
+	files, err := loadFiles(ref, diffBase{})
+	if err != nil {
+		return err
+	}
+
+	// A file can be changed in more than one part of a stash
+	found := false
+	for _, f := range files {
+		if f.name != name || (*section != "" && f.section.String() != *section) {
+			continue
+		}
+		found = true
+		diff, err := loadDiff(ref, f, diffBase{})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, diff)
+	}
+	if !found {
+		return fmt.Errorf("diff: %s is not changed in %s", name, ref)
+	}
+	return nil
+}
+
+// parseArgs parses flags that may come before or after the positional
+// arguments, e.g. "files stash@{0} -json", and returns the positional ones.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// conflictPaneTitles name the index stages shown side by side.
+var conflictPaneTitles = [3]string{"Base", "Mine", "Stash"}
+
+// conflictMarkerRe matches the first or last line of a conflict block.
+var conflictMarkerRe = regexp.MustCompile(`(?m)^(<<<<<<<|>>>>>>>)( |$)`)
+
+// newConflictList creates a configured list for conflicted files.
+func newConflictList(entries []fileEntry, width, height int) list.Model {
+	items := make([]list.Item, len(entries))
+	for i, e := range entries {
+		items[i] = fileItem{entry: e}
+	}
+
+	l := list.New(items, fileDelegate{}, width, height)
+	l.Title = "Conflicts"
+	l.SetShowStatusBar(true)
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+
+	return l
+}
+
+// conflictListHeight sizes the conflict list to its files, leaving at least
+// two thirds of the screen to the panes below it.
+func conflictListHeight(files, height int) int {
+	// Title and status bar take two lines each
+	return min(files+4, max(height/3, 5))
+}
+
+// renderConflictPanes lays out the base, mine and stash versions of a file
+// next to each other and returns the title row and the content.
+func renderConflictPanes(stages [3]conflictStage, width int) (string, string) {
+	sepWidth := lipgloss.Width(splitSep.String())
+	colWidth := max((width-2*sepWidth)/3, 10)
+
+	var titles []string
+	var lines [3][]string
+	rows := 0
+	for i, s := range stages {
+		title := conflictPaneTitles[i]
+		if !s.present {
+			title += " (deleted)"
+		}
+		titles = append(titles, conflictTitleStyle.Width(colWidth).Render(truncate(title, colWidth)))
+		if s.present {
+			lines[i] = strings.Split(strings.TrimSuffix(s.text, "\n"), "\n")
+		}
+		rows = max(rows, len(lines[i]))
+	}
+
+	var b strings.Builder
+	for r := 0; r < rows; r++ {
+		var cells []string
+		for i := range lines {
+			if r < len(lines[i]) {
+				cells = append(cells, splitCell(r+1, lines[i][r], colWidth))
+			} else {
+				cells = append(cells, splitCell(0, "", colWidth))
+			}
+		}
+		if r > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(strings.Join(cells, splitSep.String()))
+	}
+	return strings.Join(titles, splitSep.String()), b.String()
+}
+
+// editorCmd builds the command that opens a file in the user's editor,
+// taken from $VISUAL or $EDITOR and falling back to vi.
+func editorCmd(path string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		args = []string{"vi"}
+	}
+	return exec.Command(args[0], append(args[1:], path)...)
+}
+
+// hasConflictMarkers reports whether a file still contains conflict blocks.
+func hasConflictMarkers(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return conflictMarkerRe.Match(data)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// changeItem wraps a working tree change with its selection state.
+type changeItem struct {
+	entry    fileEntry
+	selected bool
+}
+
+func (i changeItem) FilterValue() string {
+	return i.entry.label()
+}
+
+// changeDelegate renders a working tree change with a checkbox.
+type changeDelegate struct{}
+
+func (d changeDelegate) Height() int                             { return 1 }
+func (d changeDelegate) Spacing() int                            { return 0 }
+func (d changeDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+
+func (d changeDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	ci, ok := item.(changeItem)
+	if !ok {
+		return
+	}
+
+	check := "[ ]"
+	if ci.selected {
+		check = "[x]"
+	}
+
+	name := truncate(ci.entry.label(), max(m.Width()-12, 20))
+
+	cursor := "  "
+	if index == m.Index() {
+		cursor = "> "
+		name = breadcrumbStyle.Render(name)
+	}
+
+	fmt.Fprintf(w, "%s%s %s %s", cursor, check, statusIcon(ci.entry.status), name)
+}
+
+// newChangeList creates a configured list for working tree changes, with
+// every change selected.
+func newChangeList(entries []fileEntry, width, height int) list.Model {
+	items := make([]list.Item, len(entries))
+	for i, e := range entries {
+		items[i] = changeItem{entry: e, selected: true}
+	}
+
+	l := list.New(items, changeDelegate{}, width, height)
+	l.Title = "Working Tree Changes"
+	l.SetShowStatusBar(true)
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+
+	return l
+}
+
+// newMessageInput creates the text input for a new stash message.
+func newMessageInput(width int) textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "Message: "
+	ti.Placeholder = "describe this stash"
+	ti.Width = max(width-12, 10)
+	return ti
+}
+
+// selectedChanges returns the selected entries of a change list.
+func selectedChanges(l list.Model) []fileEntry {
+	var entries []fileEntry
+	for _, it := range l.Items() {
+		if ci, ok := it.(changeItem); ok && ci.selected {
+			entries = append(entries, ci.entry)
+		}
+	}
+	return entries
+}
@@ -1,24 +1,326 @@
 package main
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
+// diffHunk is one "@@" section of a single-file diff.
+type diffHunk struct {
+	line   int // index of the "@@" line within the diff
+	text   string
+	marked bool
+}
+
+// diffOptions controls how a diff is rendered.
+type diffOptions struct {
+	sideBySide bool
+	syntax     bool
+	wordDiff   bool
+}
+
+// diffMarkup holds per-line decorations of a diff: syntax tokens and the
+// spans of words changed against a paired line. Either may be nil.
+type diffMarkup struct {
+	tokens [][]syntaxToken
+	spans  [][]span
+}
+
+func (d diffMarkup) tokensAt(line int) []syntaxToken {
+	if line < len(d.tokens) {
+		return d.tokens[line]
+	}
+	return nil
+}
+
+func (d diffMarkup) spansAt(line int) []span {
+	if line < len(d.spans) {
+		return d.spans[line]
+	}
+	return nil
+}
+
 // newDiffViewport creates a configured viewport for displaying a diff.
-func newDiffViewport(diff string, width, height int) viewport.Model {
+func newDiffViewport(content string, width, height int) viewport.Model {
 	vp := viewport.New(width, height)
-	vp.SetContent(colorizeDiff(diff))
+	vp.SetContent(content)
 	return vp
 }
 
-// colorizeDiff applies lipgloss styles to a unified diff string.
-func colorizeDiff(raw string) string {
+// parseHunks splits a single-file unified diff into its file header and hunks.
+func parseHunks(raw string) (string, []diffHunk) {
+	lines := strings.Split(raw, "\n")
+	var header []string
+	var hunks []diffHunk
+	var current []string
+
+	flush := func() {
+		if len(hunks) > 0 {
+			hunks[len(hunks)-1].text = strings.Join(current, "\n")
+		}
+	}
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			flush()
+			hunks = append(hunks, diffHunk{line: i})
+			current = []string{line}
+			continue
+		}
+		if len(hunks) == 0 {
+			header = append(header, line)
+		} else {
+			current = append(current, line)
+		}
+	}
+	flush()
+
+	return strings.Join(header, "\n"), hunks
+}
+
+// buildPatch assembles a patch from a file header and the given hunks.
+func buildPatch(header string, hunks []diffHunk) string {
+	parts := []string{header}
+	for _, h := range hunks {
+		parts = append(parts, h.text)
+	}
+	return strings.Join(parts, "\n") + "\n"
+}
+
+// hunkAt returns the index of the hunk containing the given diff line, or -1.
+func hunkAt(hunks []diffHunk, line int) int {
+	idx := -1
+	for i, h := range hunks {
+		if h.line > line {
+			break
+		}
+		idx = i
+	}
+	return idx
+}
+
+// renderDiff renders a diff for the viewport, with a gutter marking the
+// hunk under the cursor and the hunks selected for applying. It returns the
+// content and, for each row, the diff line it starts at.
+func renderDiff(raw string, tokens [][]syntaxToken, hunks []diffHunk, cursor int, opts diffOptions, width int) (string, []int) {
+	var markup diffMarkup
+	if opts.syntax {
+		markup.tokens = tokens
+	}
+	if opts.wordDiff {
+		markup.spans = wordDiffSpans(raw)
+	}
+
+	var rows []diffRow
+	if opts.sideBySide {
+		rows = splitRows(raw, markup, width-2)
+	} else {
+		rows = unifiedRows(raw, markup)
+	}
+
+	rowLines := make([]int, len(rows))
+	out := make([]string, len(rows))
+	for i, r := range rows {
+		rowLines[i] = r.line
+		gutter := "  "
+		if h := hunkAt(hunks, r.line); h != -1 {
+			switch {
+			case h == cursor:
+				gutter = hunkCursorStyle.Render("▌") + " "
+			case hunks[h].marked:
+				gutter = hunkMarkedStyle.Render("▌") + " "
+			}
+			if r.line == hunks[h].line {
+				if hunks[h].marked {
+					gutter = hunkMarkedStyle.Render("●") + " "
+				}
+			}
+		}
+		if len(hunks) == 0 {
+			gutter = ""
+		}
+		out[i] = gutter + r.text
+	}
+	return strings.Join(out, "\n"), rowLines
+}
+
+// rowOfLine returns the last rendered row starting at or before a diff
+// line. Side-by-side rows pair lines, so a line may not start a row itself.
+func rowOfLine(rowLines []int, line int) int {
+	row := 0
+	for i, l := range rowLines {
+		if l > line {
+			break
+		}
+		row = i
+	}
+	return row
+}
+
+// diffRow is one rendered row of a diff and the diff line it starts at.
+type diffRow struct {
+	line int
+	text string
+}
+
+// unifiedRows renders each diff line as its own row.
+func unifiedRows(raw string, markup diffMarkup) []diffRow {
+	lines := strings.Split(colorizeDiff(raw, markup), "\n")
+	rows := make([]diffRow, len(lines))
+	for i, line := range lines {
+		rows[i] = diffRow{line: i, text: line}
+	}
+	return rows
+}
+
+// splitRows renders a diff in two columns, old on the left and new on the
+// right. Runs of removed lines are paired with the added lines that follow
+// them so that changed lines sit side by side.
+func splitRows(raw string, markup diffMarkup, width int) []diffRow {
+	lines := strings.Split(raw, "\n")
+	colWidth := max((width-3)/2, 20)
+
+	var rows []diffRow
+	var oldNo, newNo int
+	inHunk := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			oldNo, newNo = parseHunkHeader(line)
+			rows = append(rows, diffRow{line: i, text: diffHunkStyle.Render(line)})
+
+		case !inHunk:
+			rows = append(rows, diffRow{line: i, text: colorizeDiff(line, diffMarkup{})})
+
+		case strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+"):
+			// Collect the run of removals and the additions that follow
+			start := i
+			var dels, adds []int
+			for i < len(lines) && strings.HasPrefix(lines[i], "-") {
+				dels = append(dels, i)
+				i++
+			}
+			for i < len(lines) && strings.HasPrefix(lines[i], "+") {
+				adds = append(adds, i)
+				i++
+			}
+			i--
+
+			for j := 0; j < max(len(dels), len(adds)); j++ {
+				left := splitCell(0, "", colWidth)
+				right := splitCell(0, "", colWidth)
+				if j < len(dels) {
+					d := dels[j]
+					left = splitCell(oldNo, markup.styleCode(d, lines[d][1:], delLine), colWidth)
+					oldNo++
+				}
+				if j < len(adds) {
+					a := adds[j]
+					right = splitCell(newNo, markup.styleCode(a, lines[a][1:], addLine), colWidth)
+					newNo++
+				}
+				rows = append(rows, diffRow{line: start + j, text: left + splitSep.String() + right})
+			}
+
+		case strings.HasPrefix(line, " ") || line == "":
+			text := markup.styleCode(i, strings.TrimPrefix(line, " "), ctxLine)
+			left := splitCell(oldNo, text, colWidth)
+			right := splitCell(newNo, text, colWidth)
+			oldNo++
+			newNo++
+			rows = append(rows, diffRow{line: i, text: left + splitSep.String() + right})
+
+		default:
+			// "\ No newline at end of file" and similar markers
+			rows = append(rows, diffRow{line: i, text: diffCtxStyle.Render(line)})
+		}
+	}
+	return rows
+}
+
+// splitCell renders one side of a side-by-side row: a line number and the
+// styled line text, truncated or padded to exactly width cells. A zero line
+// number renders an empty cell.
+func splitCell(num int, styled string, width int) string {
+	if num == 0 {
+		return strings.Repeat(" ", width)
+	}
+	prefix := lineNoStyle.Render(fmt.Sprintf("%4d ", num))
+	textWidth := width - 5
+	styled = ansi.Truncate(strings.ReplaceAll(styled, "\t", "    "), textWidth, "…")
+	pad := strings.Repeat(" ", max(textWidth-ansi.StringWidth(styled), 0))
+	return prefix + styled + pad
+}
+
+// styleCode renders the code of a diff line without its +/- marker. With
+// syntax tokens the code is highlighted on the line's background color,
+// otherwise it gets the plain line style. Changed words are emphasized.
+func (d diffMarkup) styleCode(line int, code string, ls lineStyle) string {
+	tokens := d.tokensAt(line)
+	bg := ls.bg
+	if tokens == nil {
+		tokens = []syntaxToken{{text: code, style: ls.text}}
+		bg = lipgloss.NoColor{}
+	}
+
+	spans := d.spansAt(line)
+	if spans == nil {
+		return renderTokens(tokens, bg)
+	}
+
+	var b strings.Builder
+	parts, inside := splitAtSpans(tokens, spans)
+	for i, t := range parts {
+		if inside[i] {
+			b.WriteString(t.style.Background(ls.emph).Render(t.text))
+		} else {
+			b.WriteString(t.style.Background(bg).Render(t.text))
+		}
+	}
+	return b.String()
+}
+
+// parseHunkHeader returns the starting old and new line numbers of a
+// "@@ -a,b +c,d @@" hunk header.
+func parseHunkHeader(line string) (int, int) {
+	var oldNo, newNo int
+	fields := strings.Fields(line)
+	if len(fields) >= 3 {
+		oldNo, _ = strconv.Atoi(strings.SplitN(strings.TrimPrefix(fields[1], "-"), ",", 2)[0])
+		newNo, _ = strconv.Atoi(strings.SplitN(strings.TrimPrefix(fields[2], "+"), ",", 2)[0])
+	}
+	return oldNo, newNo
+}
+
+// colorizeDiff applies lipgloss styles to a unified diff string, adding
+// syntax highlighting and changed-word emphasis from the markup.
+func colorizeDiff(raw string, markup diffMarkup) string {
 	lines := strings.Split(raw, "\n")
 	styled := make([]string, 0, len(lines))
 
-	for _, line := range lines {
+	for i, line := range lines {
+		if markup.tokensAt(i) != nil || markup.spansAt(i) != nil {
+			switch line[0] {
+			case '+':
+				styled = append(styled, diffAddStyle.Render("+")+markup.styleCode(i, line[1:], addLine))
+				continue
+			case '-':
+				styled = append(styled, diffDelStyle.Render("-")+markup.styleCode(i, line[1:], delLine))
+				continue
+			case ' ':
+				styled = append(styled, " "+markup.styleCode(i, line[1:], ctxLine))
+				continue
+			}
+		}
+
 		switch {
 		case strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- "):
 			styled = append(styled, diffHunkStyle.Render(line))
@@ -10,11 +10,13 @@ import (
 
 // fileItem wraps fileEntry to implement bubbles list.Item.
 type fileItem struct {
-	entry fileEntry
+	entry    fileEntry
+	apply    applyState // dry-run result of applying the stash, if checked
+	selected bool       // picked for applying a subset of the stash
 }
 
 func (i fileItem) FilterValue() string {
-	return i.entry.name
+	return i.entry.label()
 }
 
 // statusIcon returns the styled status indicator for a file.
@@ -28,13 +30,44 @@ func statusIcon(status string) string {
 		return statusDeleted.String()
 	case "R":
 		return statusRenamed.String()
+	case "?":
+		return statusUntracked.String()
+	case "U":
+		return statusConflict.String()
 	default:
 		return statusModified.String()
 	}
 }
 
+// sectionBadge returns the styled label for the part of a stash a file belongs to.
+func sectionBadge(section fileSection) string {
+	switch section {
+	case sectionStaged:
+		return sectionStagedStyle.Render(section.String())
+	case sectionUntracked:
+		return sectionUntrackedStyle.Render(section.String())
+	default:
+		return sectionUnstagedStyle.Render(section.String())
+	}
+}
+
+// applyBadge returns the styled dry-run result for a file, or "".
+func applyBadge(state applyState) string {
+	switch state {
+	case applyClean:
+		return applyCleanStyle.Render(state.String())
+	case applyConflict, applyBlocked:
+		return applyConflictStyle.Render(state.String())
+	case applyApplied:
+		return applyAppliedStyle.Render(state.String())
+	}
+	return ""
+}
+
 // fileDelegate renders a file item in the list.
-type fileDelegate struct{}
+type fileDelegate struct {
+	showSections bool // badge files with their stash section
+}
 
 func (d fileDelegate) Height() int                             { return 1 }
 func (d fileDelegate) Spacing() int                            { return 0 }
@@ -47,7 +80,11 @@ func (d fileDelegate) Render(w io.Writer, m list.Model, index int, item list.Ite
 	}
 
 	icon := statusIcon(fi.entry.status)
-	name := fi.entry.name
+	badge := ""
+	if d.showSections {
+		badge = sectionBadge(fi.entry.section) + " "
+	}
+	name := fi.entry.label()
 
 	// Format line stats: +10 -5
 	stats := ""
@@ -58,31 +95,38 @@ func (d fileDelegate) Render(w io.Writer, m list.Model, index int, item list.Ite
 			diffDelStyle.Render(fmt.Sprintf("-%d", fi.entry.removed))
 	}
 
-	maxWidth := m.Width() - 6 - 16 // leave room for stats
+	maxWidth := m.Width() - 6 - 16 - 10 - 9 // leave room for stats, badge and dry-run result
 	if maxWidth < 20 {
 		maxWidth = 20
 	}
-	if len(name) > maxWidth {
-		name = name[:maxWidth-1] + "…"
-	}
+	name = truncate(name, maxWidth)
 
 	cursor := "  "
 	if index == m.Index() {
 		cursor = "> "
 		name = breadcrumbStyle.Render(name)
 	}
+	if fi.selected {
+		cursor = cursor[:1] + hunkMarkedStyle.Render("●")
+	}
+
+	apply := ""
+	if fi.apply != applyUnknown {
+		apply = " " + applyBadge(fi.apply)
+	}
 
-	fmt.Fprintf(w, "%s%s %s%s", cursor, icon, name, stats)
+	fmt.Fprintf(w, "%s%s%s %s%s%s", cursor, badge, icon, name, stats, apply)
 }
 
-// newFileList creates a configured list for file entries.
-func newFileList(entries []fileEntry, width, height int) list.Model {
+// newFileList creates a configured list for file entries. Section badges
+// only make sense when the stash is compared against its own base.
+func newFileList(entries []fileEntry, showSections bool, width, height int) list.Model {
 	items := make([]list.Item, len(entries))
 	for i, e := range entries {
 		items[i] = fileItem{entry: e}
 	}
 
-	l := list.New(items, fileDelegate{}, width, height)
+	l := list.New(items, fileDelegate{showSections: showSections}, width, height)
 	l.Title = "Changed Files"
 	l.SetShowStatusBar(true)
 	l.SetFilteringEnabled(true)
@@ -90,3 +134,25 @@ func newFileList(entries []fileEntry, width, height int) list.Model {
 
 	return l
 }
+
+// selectedFiles returns the files picked in a file list, in list order.
+func selectedFiles(l list.Model) []fileEntry {
+	var entries []fileEntry
+	for _, it := range l.Items() {
+		if fi, ok := it.(fileItem); ok && fi.selected {
+			entries = append(entries, fi.entry)
+		}
+	}
+	return entries
+}
+
+// markApplyStates sets the dry-run result on every file in the list.
+// Files the stash does not change are left unmarked.
+func markApplyStates(l *list.Model, states map[string]applyState) {
+	for i, it := range l.Items() {
+		if fi, ok := it.(fileItem); ok {
+			fi.apply = states[fi.entry.name]
+			l.SetItem(i, fi)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// stashTerm is one condition of a stash query, e.g. "age:>30d".
+type stashTerm struct {
+	negate bool
+	match  func(e stashEntry, now time.Time) bool
+}
+
+// stashQuery is a parsed stash filter: any of its groups must match, and
+// every term within a group.
+type stashQuery struct {
+	groups     [][]stashTerm
+	structured bool // uses key:value terms or OR
+}
+
+// parseStashQuery parses a filter like "branch:feature/x age:>30d OR
+// file:*.sql". Terms are ANDed, AND binds tighter than OR, and a leading
+// "-" negates a term. Supported keys are branch, message, author ("me" for
+// the configured user), file (a path or glob), age (">30d" is older than,
+// "<2w" or "2w" newer than; units h, d, w, m, y) and untracked (yes/no).
+// Anything else is matched fuzzily against the message and branch.
+func parseStashQuery(query string) stashQuery {
+	q := stashQuery{groups: [][]stashTerm{nil}}
+	for _, word := range strings.Fields(query) {
+		switch strings.ToUpper(word) {
+		case "OR", "|":
+			q.structured = true
+			q.groups = append(q.groups, nil)
+			continue
+		case "AND", "&":
+			continue
+		}
+		term, structured := parseStashTerm(word)
+		q.structured = q.structured || structured
+		last := len(q.groups) - 1
+		q.groups[last] = append(q.groups[last], term)
+	}
+	return q
+}
+
+// parseStashTerm parses a single query word and reports whether it is a
+// key:value term.
+func parseStashTerm(word string) (stashTerm, bool) {
+	var t stashTerm
+	if len(word) > 1 && word[0] == '-' {
+		t.negate = true
+		word = word[1:]
+	}
+
+	key, value, ok := strings.Cut(word, ":")
+	if ok && value != "" {
+		if match := keyMatcher(strings.ToLower(key), value); match != nil {
+			t.match = match
+			return t, true
+		}
+	}
+
+	t.match = func(e stashEntry, _ time.Time) bool {
+		return len(list.DefaultFilter(word, []string{stashItem{entry: e}.FilterValue()})) > 0
+	}
+	return t, t.negate
+}
+
+// keyMatcher returns the matcher for a key:value term, or nil if the key or
+// value is not understood.
+func keyMatcher(key, value string) func(stashEntry, time.Time) bool {
+	lower := strings.ToLower(value)
+	switch key {
+	case "branch", "b":
+		return func(e stashEntry, _ time.Time) bool {
+			return strings.Contains(strings.ToLower(e.branch), lower)
+		}
+	case "message", "msg":
+		return func(e stashEntry, _ time.Time) bool {
+			return strings.Contains(strings.ToLower(e.message), lower)
+		}
+	case "author":
+		return func(e stashEntry, _ time.Time) bool {
+			if lower == "me" {
+				return e.author != "" && e.author == currentUser()
+			}
+			return strings.Contains(strings.ToLower(e.author), lower)
+		}
+	case "file", "path":
+		match := compilePathQuery(value)
+		return func(e stashEntry, _ time.Time) bool {
+			for _, p := range e.paths {
+				if match(p) {
+					return true
+				}
+			}
+			return false
+		}
+	case "untracked":
+		var want bool
+		switch lower {
+		case "yes", "y", "true":
+			want = true
+		case "no", "n", "false":
+		default:
+			return nil
+		}
+		return func(e stashEntry, _ time.Time) bool {
+			return e.untracked == want
+		}
+	case "age":
+		older := strings.HasPrefix(value, ">")
+		d, ok := parseAge(strings.TrimLeft(value, "<>"))
+		if !ok {
+			return nil
+		}
+		return func(e stashEntry, now time.Time) bool {
+			if older {
+				return now.Sub(e.date) > d
+			}
+			return now.Sub(e.date) < d
+		}
+	}
+	return nil
+}
+
+// parseAge parses a duration like "30d" or "2w".
+func parseAge(s string) (time.Duration, bool) {
+	units := map[string]time.Duration{
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"m": 30 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+	if len(s) < 2 {
+		return 0, false
+	}
+	unit, ok := units[strings.ToLower(s[len(s)-1:])]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// matches reports whether a stash satisfies the query.
+func (q stashQuery) matches(e stashEntry, now time.Time) bool {
+	for _, group := range q.groups {
+		if len(group) == 0 {
+			continue
+		}
+		ok := true
+		for _, t := range group {
+			if t.match(e, now) == t.negate {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stashFilter returns a list filter for stashes. Plain text is ranked by
+// the default fuzzy filter; queries with key:value terms or OR keep the
+// stashes that match in list order.
+func stashFilter(entries []stashEntry) list.FilterFunc {
+	return func(term string, targets []string) []list.Rank {
+		q := parseStashQuery(term)
+		if !q.structured {
+			return list.DefaultFilter(term, targets)
+		}
+		now := time.Now()
+		var ranks []list.Rank
+		for i, e := range entries {
+			if i < len(targets) && q.matches(e, now) {
+				ranks = append(ranks, list.Rank{Index: i})
+			}
+		}
+		return ranks
+	}
+}
+
+var (
+	currentUserOnce sync.Once
+	currentUserName string
+)
+
+// currentUser returns the configured git user name, for "author:me".
+func currentUser() string {
+	currentUserOnce.Do(func() {
+		currentUserName, _ = runGit("config", "user.name")
+	})
+	return currentUserName
+}
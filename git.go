@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // repoDir is the directory to run git commands in. Set via -C flag.
@@ -12,18 +16,47 @@ var repoDir string
 
 // runGit executes a git command and returns its trimmed stdout.
 func runGit(args ...string) (string, error) {
+	out, err := runGitRaw(args...)
+	return strings.TrimSpace(out), err
+}
+
+// runGitRaw executes a git command and returns its stdout untouched, for
+// output formats where leading whitespace is significant.
+func runGitRaw(args ...string) (string, error) {
+	return runGitInput("", args...)
+}
+
+// runGitInput executes a git command with input on stdin and returns its
+// stdout untouched.
+func runGitInput(input string, args ...string) (string, error) {
+	return runGitEnv(nil, input, args...)
+}
+
+// runGitEnv is runGitInput with extra environment variables, e.g. to point
+// git at a temporary index.
+func runGitEnv(env []string, input string, args ...string) (string, error) {
+	sub := args[0]
+	if sub == "-C" && len(args) > 2 {
+		sub = args[2]
+	}
 	if repoDir != "" {
 		args = append([]string{"-C", repoDir}, args...)
 	}
 	cmd := exec.Command("git", args...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
 	out, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+			return "", fmt.Errorf("git %s: %s", sub, strings.TrimSpace(string(exitErr.Stderr)))
 		}
 		return "", err
 	}
-	return strings.TrimSpace(string(out)), nil
+	return string(out), nil
 }
 
 // isGitRepo checks whether the current (or specified) directory is inside a git repo.
@@ -38,37 +71,64 @@ type stashEntry struct {
 	ref     string // e.g. stash@{0}
 	branch  string
 	message string
+
+	sha         string
+	date        time.Time // when the stash was created
+	author      string
+	base        string   // SHA of the commit the stash was made on (stash^1)
+	baseSubject string   // subject of the base commit
+	untracked   bool     // saved with untracked files (has a third parent)
+	paths       []string // every path the stash touches, untracked ones included
+	added       int      // lines added over all paths
+	removed     int      // lines removed over all paths
 }
 
-// parseStashList parses the output of `git stash list`.
-// Each line looks like: stash@{0}: On main: fix login bug
-// or: stash@{0}: WIP on main: abc1234 commit message
+// stashListFormat makes `git stash list` print one stash per line with
+// NUL-separated fields: reflog subject, SHA, commit time, author, parents.
+const stashListFormat = "--format=%gs%x00%H%x00%ct%x00%an%x00%P"
+
+// parseStashList parses the output of `git stash list` with stashListFormat.
+// The reflog subject looks like: On main: fix login bug
+// or: WIP on main: abc1234 commit message
 func parseStashList(raw string) []stashEntry {
 	if raw == "" {
 		return nil
 	}
 	lines := strings.Split(raw, "\n")
 	entries := make([]stashEntry, 0, len(lines))
-	for i, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
+		i := len(entries)
 		e := stashEntry{index: i, ref: fmt.Sprintf("stash@{%d}", i)}
 
-		// Split on first ": " to get ref and rest
-		parts := strings.SplitN(line, ": ", 3)
-		if len(parts) >= 3 {
-			// parts[1] is like "On main" or "WIP on main"
-			branchPart := parts[1]
+		fields := strings.Split(line, "\x00")
+		subject := fields[0]
+		if len(fields) == 5 {
+			e.sha = fields[1]
+			if ts, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+				e.date = time.Unix(ts, 0)
+			}
+			e.author = fields[3]
+			parents := strings.Fields(fields[4])
+			if len(parents) > 0 {
+				e.base = parents[0]
+			}
+			e.untracked = len(parents) >= 3
+		}
+
+		// Split on first ": " to get branch and message
+		parts := strings.SplitN(subject, ": ", 2)
+		if len(parts) == 2 {
+			// parts[0] is like "On main" or "WIP on main"
+			branchPart := parts[0]
 			branchPart = strings.TrimPrefix(branchPart, "WIP on ")
 			branchPart = strings.TrimPrefix(branchPart, "On ")
 			e.branch = branchPart
-			e.message = parts[2]
-		} else if len(parts) == 2 {
 			e.message = parts[1]
 		} else {
-			e.message = line
+			e.message = subject
 		}
 
 		entries = append(entries, e)
@@ -76,101 +136,381 @@ func parseStashList(raw string) []stashEntry {
 	return entries
 }
 
+// fileSection tells which part of a stash a file change belongs to.
+type fileSection int
+
+const (
+	sectionUnstaged  fileSection = iota // working tree changes (stash^2..stash)
+	sectionStaged                       // index changes (stash^1..stash^2)
+	sectionUntracked                    // untracked files saved with -u (stash^3)
+)
+
+func (s fileSection) String() string {
+	switch s {
+	case sectionStaged:
+		return "staged"
+	case sectionUntracked:
+		return "untracked"
+	}
+	return "unstaged"
+}
+
 // fileEntry represents a file changed in a stash.
 type fileEntry struct {
 	status  string // A, M, D, R, etc.
-	name    string
+	name    string // path in the stash
+	oldName string // path before a rename or copy, empty otherwise
+	section fileSection
 	added   int // lines added
 	removed int // lines removed
 }
 
-// parseFileList parses the output of `git stash show --name-status`.
-// Each line is tab-delimited: M\tfile.go or R100\told.go\tnew.go
-func parseFileList(raw string) []fileEntry {
+// paths returns the pathspecs covering a file entry, including the old
+// path of a rename so git can pair both sides.
+func (f fileEntry) paths() []string {
+	if f.oldName != "" {
+		return []string{literalPath(f.oldName), literalPath(f.name)}
+	}
+	return []string{literalPath(f.name)}
+}
+
+// label is the display form of a file entry's path(s).
+func (f fileEntry) label() string {
+	if f.oldName != "" {
+		return f.oldName + " -> " + f.name
+	}
+	return f.name
+}
+
+// literalPath turns a repository-relative path into a pathspec that matches
+// only that path, even if it contains glob characters or git runs in a
+// subdirectory.
+func literalPath(name string) string {
+	return ":(top,literal)" + name
+}
+
+// splitNUL splits NUL-terminated records, dropping the final terminator.
+func splitNUL(raw string) []string {
 	if raw == "" {
 		return nil
 	}
-	lines := strings.Split(raw, "\n")
-	entries := make([]fileEntry, 0, len(lines))
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "\t")
-		if len(parts) < 2 {
-			continue
-		}
-		status := parts[0]
-		name := parts[1]
+	return strings.Split(strings.TrimSuffix(raw, "\x00"), "\x00")
+}
+
+// parseFileList parses the output of `git diff --name-status -z`.
+// Records are NUL-terminated: "M\0file.go\0", or for renames and copies
+// "R100\0old.go\0new.go\0".
+func parseFileList(raw string) []fileEntry {
+	records := splitNUL(raw)
+	entries := make([]fileEntry, 0, len(records)/2)
+	for i := 0; i+1 < len(records); i += 2 {
+		e := fileEntry{status: records[i], name: records[i+1]}
 
-		// Normalize rename status (R100 -> R)
-		if strings.HasPrefix(status, "R") {
-			status = "R"
-			if len(parts) >= 3 {
-				name = parts[1] + " -> " + parts[2]
+		// Normalize rename and copy status (R100 -> R)
+		if strings.HasPrefix(e.status, "R") || strings.HasPrefix(e.status, "C") {
+			e.status = e.status[:1]
+			if i+2 < len(records) {
+				e.oldName, e.name = records[i+1], records[i+2]
+				i++
 			}
 		}
+		if e.status == "C" {
+			e.status = "A"
+		}
 
-		entries = append(entries, fileEntry{status: status, name: name})
+		entries = append(entries, e)
 	}
 	return entries
 }
 
 // loadStashes fetches and parses all stashes.
 func loadStashes() ([]stashEntry, error) {
-	out, err := runGit("stash", "list")
+	out, err := runGit("stash", "list", stashListFormat)
 	if err != nil {
 		return nil, err
 	}
-	return parseStashList(out), nil
+	entries := parseStashList(out)
+
+	// Base subjects, paths and line stats only feed display, filtering and
+	// sorting, so a failure is not fatal
+	_ = loadBaseSubjects(entries)
+	_ = loadStashPaths(entries)
+	return entries, nil
 }
 
-// parseNumstat parses `git stash show --numstat` output.
-// Each line: "10\t5\tfile.go" (added, removed, filename).
-// Binary files show "-\t-\tfile".
-func parseNumstat(raw string) map[string][2]int {
-	result := make(map[string][2]int)
-	if raw == "" {
-		return result
+// loadBaseSubjects fills in the subject of every stash's base commit with
+// one git call.
+func loadBaseSubjects(entries []stashEntry) error {
+	args := []string{"log", "--no-walk", "--format=%H%x00%s"}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if e.base != "" && !seen[e.base] {
+			seen[e.base] = true
+			args = append(args, e.base)
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	out, err := runGit(args...)
+	if err != nil {
+		return err
+	}
+	subjects := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if sha, subject, ok := strings.Cut(line, "\x00"); ok {
+			subjects[sha] = subject
+		}
+	}
+	for i := range entries {
+		entries[i].baseSubject = subjects[entries[i].base]
+	}
+	return nil
+}
+
+// loadStashPaths fills in the paths every stash touches and its line
+// stats: the tracked ones for all stashes in one go, then the untracked
+// ones per stash.
+func loadStashPaths(entries []stashEntry) error {
+	out, err := runGitRaw("stash", "list", "--diff-merges=first-parent", "--numstat", "-z", "--format=%x01%H")
+	if err != nil {
+		return err
+	}
+	stats := parseStashStats(out)
+	for i := range entries {
+		e := &entries[i]
+		addStats(e, stats[e.sha])
+		if !e.untracked {
+			continue
+		}
+		from, to, err := sectionRevs(e.sha, sectionUntracked)
+		if err != nil {
+			return err
+		}
+		out, err := runGitRaw("diff", "--numstat", "-z", from, to)
+		if err != nil {
+			return err
+		}
+		addStats(e, parseNumstat(out))
 	}
-	for _, line := range strings.Split(raw, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" {
+	return nil
+}
+
+// parseStashStats parses `git stash list --numstat -z --format=%x01%H`
+// output into numstat results keyed by stash SHA. Each record is
+// "\x01sha\0\n" followed by the stash's numstat records.
+func parseStashStats(raw string) map[string]map[string][2]int {
+	stats := map[string]map[string][2]int{}
+	for _, rec := range strings.Split(raw, "\x01") {
+		sha, rest, ok := strings.Cut(rec, "\x00")
+		if !ok {
 			continue
 		}
-		parts := strings.Split(line, "\t")
+		stats[sha] = parseNumstat(strings.TrimPrefix(rest, "\n"))
+	}
+	return stats
+}
+
+// addStats adds numstat results to a stash's paths and line counts.
+func addStats(e *stashEntry, stats map[string][2]int) {
+	paths := make([]string, 0, len(stats))
+	for name, s := range stats {
+		paths = append(paths, name)
+		e.added += s[0]
+		e.removed += s[1]
+	}
+	sort.Strings(paths)
+	e.paths = append(e.paths, paths...)
+}
+
+// parseNumstat parses `git diff --numstat -z` output into line stats keyed
+// by path. Records look like "10\t5\tfile.go\0" (added, removed, path);
+// renames leave the path empty and follow with "old\0new\0". Binary files
+// show "-\t-\t".
+func parseNumstat(raw string) map[string][2]int {
+	result := make(map[string][2]int)
+	records := splitNUL(raw)
+	for i := 0; i < len(records); i++ {
+		parts := strings.SplitN(records[i], "\t", 3)
 		if len(parts) < 3 {
 			continue
 		}
 		added, _ := strconv.Atoi(parts[0])   // "-" for binary → 0
 		removed, _ := strconv.Atoi(parts[1]) // "-" for binary → 0
-		// For renames, parts[2] may contain "{old => new}" syntax
 		name := parts[2]
+		if name == "" && i+2 < len(records) {
+			// Rename: keyed by the new path
+			name = records[i+2]
+			i += 2
+		}
 		result[name] = [2]int{added, removed}
 	}
 	return result
 }
 
-// loadFiles fetches the list of changed files for a stash.
-func loadFiles(ref string) ([]fileEntry, error) {
-	out, err := runGit("stash", "show", "--name-status", ref)
+// baseKind selects what a stash is compared against.
+type baseKind int
+
+const (
+	baseStash      baseKind = iota // the commit the stash was made on
+	baseHead                       // the current HEAD
+	baseWorktree                   // the current working tree
+	baseRev                        // any commit, branch or other revision
+	baseOtherStash                 // another stash, to compare two stashes
+)
+
+// diffBase is what a stash is compared against when listing files and diffs.
+type diffBase struct {
+	kind baseKind
+	rev  string // for baseRev and baseOtherStash
+	name string // display name for baseOtherStash, e.g. stash@{3}
+}
+
+// label describes the base for breadcrumbs and hints.
+func (b diffBase) label() string {
+	switch b.kind {
+	case baseHead:
+		return "HEAD"
+	case baseWorktree:
+		return "working tree"
+	case baseRev:
+		return b.rev
+	case baseOtherStash:
+		return b.name
+	}
+	return "stash base"
+}
+
+// revs returns the git diff arguments comparing the base with a stash, or
+// nil for the stash base, which is diffed per stash section instead.
+func (b diffBase) revs(ref string) []string {
+	switch b.kind {
+	case baseHead:
+		return []string{"HEAD", ref}
+	case baseWorktree:
+		// Reversed so the working tree is the old side
+		return []string{"-R", ref}
+	case baseRev, baseOtherStash:
+		return []string{b.rev, ref}
+	}
+	return nil
+}
+
+// loadFiles fetches the list of changed files for a stash. Against the stash
+// base the files are split into the stash's staged, unstaged and untracked
+// parts; against any other base the stash's working tree state is compared
+// as a whole, plus its untracked files.
+func loadFiles(ref string, base diffBase) ([]fileEntry, error) {
+	if revs := base.revs(ref); revs != nil {
+		return loadAgainstBase(ref, base)
+	}
+
+	var entries []fileEntry
+	for _, section := range []fileSection{sectionStaged, sectionUnstaged, sectionUntracked} {
+		if section == sectionUntracked && !hasUntracked(ref) {
+			continue
+		}
+		from, to, err := sectionRevs(ref, section)
+		if err != nil {
+			return nil, err
+		}
+		files, err := loadSection(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			files[i].section = section
+		}
+		entries = append(entries, files...)
+	}
+	return entries, nil
+}
+
+// loadAgainstBase lists the files of a stash that differ from a base other
+// than its own. Untracked files live in their own root commit, so they are
+// compared separately, limited to their paths, and marked as untracked.
+func loadAgainstBase(ref string, base diffBase) ([]fileEntry, error) {
+	entries, err := loadSection(base.revs(ref)...)
+	if err != nil || !hasUntracked(ref) {
+		return entries, err
+	}
+
+	out, err := runGitRaw("ls-tree", "-r", "--full-tree", "--name-only", "-z", ref+"^3")
+	if err != nil {
+		return nil, err
+	}
+	names := splitNUL(out)
+	untrackedNames := map[string]bool{}
+	args := append(base.revs(ref+"^3"), "--")
+	for _, name := range names {
+		untrackedNames[name] = true
+		args = append(args, literalPath(name))
+	}
+	env, cleanup, err := untrackedEnv(base, names)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	untracked, err := loadSectionEnv(env, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The stash's own tree lacks untracked files, so drop what that
+	// comparison says about them
+	tracked := entries[:0]
+	for _, e := range entries {
+		if !untrackedNames[e.name] {
+			tracked = append(tracked, e)
+		}
+	}
+	for i := range untracked {
+		untracked[i].section = sectionUntracked
+	}
+	return append(tracked, untracked...), nil
+}
+
+// untrackedEnv returns the environment for comparing a stash's untracked
+// files with a base. Against the working tree the files must be compared
+// with what is on disk, which git diff only does for tracked files, so git
+// is pointed at a copy of the index that tracks them.
+func untrackedEnv(base diffBase, names []string) ([]string, func(), error) {
+	if base.kind != baseWorktree {
+		return nil, func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "stash-explorer-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	env, err := worktreeIndex(dir, names)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return env, cleanup, nil
+}
+
+// loadSection lists the files changed between revisions with line stats.
+// revs are passed to git diff as is.
+func loadSection(revs ...string) ([]fileEntry, error) {
+	return loadSectionEnv(nil, revs...)
+}
+
+// loadSectionEnv is loadSection with extra environment variables.
+func loadSectionEnv(env []string, revs ...string) ([]fileEntry, error) {
+	out, err := runGitEnv(env, "", append([]string{"diff", "--name-status", "-z"}, revs...)...)
 	if err != nil {
 		return nil, err
 	}
 	entries := parseFileList(out)
 
 	// Get line stats
-	numOut, err := runGit("stash", "show", "--numstat", ref)
+	numOut, err := runGitEnv(env, "", append([]string{"diff", "--numstat", "-z"}, revs...)...)
 	if err == nil {
 		stats := parseNumstat(numOut)
 		for i := range entries {
-			name := entries[i].name
-			// For renames, try the new name
-			if idx := strings.Index(name, " -> "); idx != -1 {
-				name = name[idx+4:]
-			}
-			if s, ok := stats[name]; ok {
+			if s, ok := stats[entries[i].name]; ok {
 				entries[i].added = s[0]
 				entries[i].removed = s[1]
 			}
@@ -180,13 +520,54 @@ func loadFiles(ref string) ([]fileEntry, error) {
 	return entries, nil
 }
 
+// hasUntracked reports whether a stash was saved with untracked files.
+func hasUntracked(ref string) bool {
+	_, err := runGit("rev-parse", "--verify", "--quiet", ref+"^3")
+	return err == nil
+}
+
+// sectionRevs returns the pair of revisions to diff for a part of a stash.
+// A stash commit's first parent is its base, the second holds the index and
+// the optional third holds untracked files as a root commit.
+func sectionRevs(ref string, section fileSection) (string, string, error) {
+	switch section {
+	case sectionStaged:
+		return ref + "^1", ref + "^2", nil
+	case sectionUntracked:
+		empty, err := runGit("hash-object", "-t", "tree", "/dev/null")
+		if err != nil {
+			return "", "", err
+		}
+		return empty, ref + "^3", nil
+	}
+	return ref + "^2", ref, nil
+}
+
 // loadDiff fetches the diff for a specific file in a stash.
-func loadDiff(ref, file string) (string, error) {
-	// For renamed files, extract the new filename
-	if idx := strings.Index(file, " -> "); idx != -1 {
-		file = file[idx+4:]
+func loadDiff(ref string, file fileEntry, base diffBase) (string, error) {
+	revs := base.revs(ref)
+	var env []string
+	if revs != nil && file.section == sectionUntracked {
+		revs = base.revs(ref + "^3")
+		var cleanup func()
+		var err error
+		if env, cleanup, err = untrackedEnv(base, []string{file.name}); err != nil {
+			return "", err
+		}
+		defer cleanup()
+	}
+	if revs == nil {
+		from, to, err := sectionRevs(ref, file.section)
+		if err != nil {
+			return "", err
+		}
+		revs = []string{from, to}
 	}
-	return runGit("diff", ref+"^", ref, "--", file)
+	// Keep trailing whitespace so the diff can be turned back into a patch
+	args := append(append([]string{"diff"}, revs...), "--")
+	args = append(args, file.paths()...)
+	out, err := runGitEnv(env, "", args...)
+	return strings.TrimRight(out, "\n"), err
 }
 
 // applyStash applies an entire stash to the working tree.
@@ -195,11 +576,975 @@ func applyStash(ref string) error {
 	return err
 }
 
-// applyFile restores a single file from a stash into the working tree.
-func applyFile(ref, file string) error {
-	if idx := strings.Index(file, " -> "); idx != -1 {
-		file = file[idx+4:]
+// applyState is the outcome of a dry run of applying one file of a stash.
+type applyState int
+
+const (
+	applyUnknown  applyState = iota
+	applyClean               // applies without conflicts
+	applyConflict            // clashes with the working tree
+	applyApplied             // the working tree already has the change
+	applyBlocked             // local edits make git refuse the whole apply
+)
+
+// String returns the label shown next to a file.
+func (s applyState) String() string {
+	switch s {
+	case applyClean:
+		return "clean"
+	case applyConflict:
+		return "conflict"
+	case applyApplied:
+		return "applied"
+	case applyBlocked:
+		return "local edits"
+	}
+	return ""
+}
+
+// checkApply dry-runs applying a stash and returns the outcome for every file
+// it changes, by path. Like `git stash apply`, which merges into the index and
+// refuses to touch files with unstaged edits, tracked files with such edits
+// are blocked and the rest are checked by applying their patch to the index
+// with `git apply --check --cached`, forwards and in reverse. Untracked files
+// block the apply if something is already on disk at their path. Nothing in
+// the working tree or index is touched.
+func checkApply(ref string) (map[string]applyState, error) {
+	// git apply resolves paths from the current directory
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	atRoot := func(args ...string) []string {
+		return append([]string{"-C", root}, args...)
+	}
+
+	out, err := runGitRaw("diff", "--name-only", "-z")
+	if err != nil {
+		return nil, err
+	}
+	edited := map[string]bool{}
+	for _, name := range splitNUL(out) {
+		edited[name] = true
+	}
+
+	states := map[string]applyState{}
+	tracked, err := loadSection(ref+"^1", ref)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range tracked {
+		if edited[f.name] || (f.oldName != "" && edited[f.oldName]) {
+			states[f.name] = applyBlocked
+			continue
+		}
+		args := append([]string{"diff", "--binary", ref + "^1", ref, "--"}, f.paths()...)
+		patch, err := runGitRaw(args...)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case runGitCheck(patch, atRoot("apply", "--check", "--cached")...):
+			states[f.name] = applyClean
+		case runGitCheck(patch, atRoot("apply", "--check", "--cached", "-R")...):
+			states[f.name] = applyApplied
+		default:
+			states[f.name] = applyConflict
+		}
+	}
+
+	if !hasUntracked(ref) {
+		return states, nil
+	}
+	from, to, err := sectionRevs(ref, sectionUntracked)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := loadSection(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range untracked {
+		// git will not restore an untracked file over anything, even an
+		// identical copy
+		if _, err := os.Lstat(filepath.Join(root, f.name)); err == nil {
+			states[f.name] = applyBlocked
+		} else {
+			states[f.name] = applyClean
+		}
+	}
+	return states, nil
+}
+
+// runGitCheck runs a git command with input on stdin and reports whether
+// it succeeded.
+func runGitCheck(input string, args ...string) bool {
+	_, err := runGitInput(input, args...)
+	return err == nil
+}
+
+// droppedStash remembers a removed stash so it can be stored again.
+type droppedStash struct {
+	sha     string
+	subject string // reflog subject, e.g. "On main: fix login bug"
+}
+
+// resolveStash looks up the commit and reflog subject behind a stash ref.
+func resolveStash(ref string) (droppedStash, error) {
+	out, err := runGit("log", "-g", "-1", "--format=%H%x00%gs", ref)
+	if err != nil {
+		return droppedStash{}, err
+	}
+	sha, subject, _ := strings.Cut(out, "\x00")
+	return droppedStash{sha: sha, subject: subject}, nil
+}
+
+// checkStash resolves a stash ref and makes sure it still holds the commit
+// the user picked. Refs shift when stashes are pushed or dropped outside
+// the app, so a stale list could otherwise hit a different stash.
+func checkStash(ref, sha string) (droppedStash, error) {
+	d, err := resolveStash(ref)
+	if err != nil {
+		return droppedStash{}, err
+	}
+	if d.sha != sha {
+		return droppedStash{}, fmt.Errorf("%s changed, reload and try again", ref)
+	}
+	return d, nil
+}
+
+// parseStatus parses the output of `git status --porcelain -z`.
+// Each record is "XY path\0"; renames and copies are followed by an
+// extra "orig\0" record. Untracked files get the status "?".
+func parseStatus(raw string) []fileEntry {
+	if raw == "" {
+		return nil
+	}
+	records := splitNUL(raw)
+	entries := make([]fileEntry, 0, len(records))
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		if len(rec) < 4 {
+			continue
+		}
+		xy, name := rec[:2], rec[3:]
+		oldName := ""
+
+		status := string(xy[0])
+		if xy[0] == ' ' {
+			status = string(xy[1])
+		}
+		switch {
+		case xy == "??":
+			status = "?"
+		case status == "R" || status == "C":
+			if i+1 < len(records) {
+				i++
+				oldName = records[i]
+			}
+			if status == "C" {
+				status = "A"
+			}
+		}
+
+		entries = append(entries, fileEntry{status: status, name: name, oldName: oldName})
+	}
+	return entries
+}
+
+// loadWorktreeChanges lists the tracked and untracked changes in the working tree.
+func loadWorktreeChanges() ([]fileEntry, error) {
+	out, err := runGitRaw("status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(out), nil
+}
+
+// pushStash stashes the given working tree changes. Untracked files are
+// only picked up when includeUntracked is set.
+func pushStash(message string, files []fileEntry, includeUntracked bool) error {
+	args := []string{"stash", "push"}
+	if includeUntracked {
+		args = append(args, "--include-untracked")
+	}
+	if message != "" {
+		args = append(args, "-m", message)
+	}
+	args = append(args, "--")
+	for _, f := range files {
+		args = append(args, f.paths()...)
+	}
+	_, err := runGit(args...)
+	return err
+}
+
+// popStash applies a stash and removes it from the stash list. sha is the
+// commit the user picked, see checkStash.
+func popStash(ref, sha string) (droppedStash, error) {
+	d, err := checkStash(ref, sha)
+	if err != nil {
+		return droppedStash{}, err
+	}
+	if _, err := runGit("stash", "pop", ref); err != nil {
+		return droppedStash{}, err
+	}
+	return d, nil
+}
+
+// dropStash removes a stash from the stash list. sha is the commit the user
+// picked, see checkStash.
+func dropStash(ref, sha string) (droppedStash, error) {
+	d, err := checkStash(ref, sha)
+	if err != nil {
+		return droppedStash{}, err
+	}
+	if _, err := runGit("stash", "drop", ref); err != nil {
+		return droppedStash{}, err
+	}
+	return d, nil
+}
+
+// branchFromStash checks out a new branch at the commit a stash was made on
+// and applies the stash there, index included. Unless keep is set the stash
+// is then dropped, as `git stash branch` does. The working tree is
+// snapshotted first; if the apply fails, the previous branch and the
+// snapshot are checked out again and the new branch is deleted.
+func branchFromStash(name, ref string, keep bool) (droppedStash, error) {
+	d, err := resolveStash(ref)
+	if err != nil {
+		return droppedStash{}, err
+	}
+	prev, err := runGit("symbolic-ref", "-q", "--short", "HEAD")
+	if err != nil {
+		// Detached HEAD
+		if prev, err = runGit("rev-parse", "HEAD"); err != nil {
+			return droppedStash{}, err
+		}
+	}
+	if err := saveSnapshot(fmt.Sprintf("Branch %s from %s", name, ref)); err != nil {
+		return droppedStash{}, fmt.Errorf("no branch created, could not save a snapshot: %w", err)
+	}
+	snap, err := runGit("rev-parse", snapshotRef)
+	if err != nil {
+		return droppedStash{}, err
+	}
+
+	if _, err := runGit("checkout", "-q", "-b", name, d.sha+"^1"); err != nil {
+		return droppedStash{}, err
+	}
+	if _, err := runGit("stash", "apply", "--index", d.sha); err != nil {
+		// The apply may have changed some files before it failed
+		if _, backErr := runGit("checkout", "-q", "-f", prev); backErr != nil {
+			return droppedStash{}, fmt.Errorf("%w; staying on %s: %w", err, name, backErr)
+		}
+		_, _ = runGit("branch", "-q", "-D", name)
+		if backErr := checkoutSnapshot(snap); backErr != nil {
+			return droppedStash{}, fmt.Errorf("%w; local changes not restored, see Ctrl+T: %w", err, backErr)
+		}
+		return droppedStash{}, err
+	}
+	if keep {
+		return droppedStash{}, nil
+	}
+	return dropStash(ref, d.sha)
+}
+
+// commitMessageFile writes a stash's message to a file for editing into a
+// commit message and returns its path.
+func commitMessageFile(e stashEntry) (string, error) {
+	gitDir, err := runGit("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(gitDir, "STASH_EDITMSG")
+	text := e.message + "\n\n" +
+		"# Committing " + e.ref + " on top of HEAD. Files you have changed keep\n" +
+		"# your changes; the rest are updated. Lines starting with '#' are\n" +
+		"# ignored, and an empty message aborts the commit.\n"
+	return path, os.WriteFile(path, []byte(text), 0o644)
+}
+
+// readCommitMessage reads an edited commit message, dropping comment lines,
+// and removes the file.
+func readCommitMessage(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	_ = os.Remove(path)
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// commitFromStash commits the changes of a stash, untracked files included,
+// on top of HEAD and returns the new commit. The commit is built in a
+// temporary index and made with `git commit`, so hooks and signing apply
+// and unrelated staged changes are not included. Committed files without
+// local changes are then updated in the index and working tree; files with
+// local changes only get their index entry updated, keeping those changes.
+func commitFromStash(e stashEntry, message string) (string, error) {
+	head, err := runGit("rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "stash-explorer-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+	if _, err := runGitEnv(env, "", "read-tree", head); err != nil {
+		return "", err
+	}
+
+	diffs := [][2]string{{e.sha + "^1", e.sha}}
+	if e.untracked {
+		from, to, err := sectionRevs(e.sha, sectionUntracked)
+		if err != nil {
+			return "", err
+		}
+		diffs = append(diffs, [2]string{from, to})
+	}
+	for _, d := range diffs {
+		patch, err := runGitRaw("diff", "--binary", "--full-index", d[0], d[1])
+		if err != nil {
+			return "", err
+		}
+		if patch == "" {
+			continue
+		}
+		if _, err := runGitEnv(env, patch, "apply", "--cached", "--3way", "-"); err != nil {
+			return "", fmt.Errorf("%s does not apply cleanly to HEAD: %w", e.ref, err)
+		}
+	}
+
+	tree, err := runGitEnv(env, "", "write-tree")
+	if err != nil {
+		return "", err
+	}
+	tree = strings.TrimSpace(tree)
+	if headTree, _ := runGit("rev-parse", head+"^{tree}"); tree == headTree {
+		return "", fmt.Errorf("nothing to commit, HEAD already has the changes of %s", e.ref)
+	}
+
+	// Note which files have local changes before HEAD moves
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	// Without rename detection both sides of a rename are listed
+	out, err := runGitRaw("diff", "--name-only", "--no-renames", "-z", head, tree)
+	if err != nil {
+		return "", err
+	}
+	committed := splitNUL(out)
+	out, err = runGitRaw("diff", "--name-only", "--no-renames", "-z", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	changed := map[string]bool{}
+	for _, name := range splitNUL(out) {
+		changed[name] = true
+	}
+	out, err = runGitRaw("ls-tree", "-r", "--name-only", "-z", "--full-tree", head)
+	if err != nil {
+		return "", err
+	}
+	inHead := map[string]bool{}
+	for _, name := range splitNUL(out) {
+		inHead[name] = true
+	}
+	var clean, dirty []string
+	for _, name := range committed {
+		_, statErr := os.Lstat(filepath.Join(root, name))
+		// A file missing from HEAD but on disk is an untracked local file
+		if changed[name] || (!inHead[name] && statErr == nil) {
+			dirty = append(dirty, literalPath(name))
+		} else {
+			clean = append(clean, literalPath(name))
+		}
+	}
+
+	if _, err := runGitEnv(env, message+"\n", "commit", "-q", "--cleanup=verbatim", "-F", "-"); err != nil {
+		return "", err
+	}
+	commit, err := runGit("rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if len(clean) > 0 {
+		args := append([]string{"restore", "--source=HEAD", "--staged", "--worktree", "--"}, clean...)
+		if _, err := runGit(args...); err != nil {
+			return commit, err
+		}
+	}
+	if len(dirty) > 0 {
+		_, err = runGit(append([]string{"reset", "-q", "--"}, dirty...)...)
+	}
+	return commit, err
+}
+
+// byIndexDesc returns stashes ordered from the bottom of the stash list up,
+// so that dropping one does not shift the refs of those still to come.
+func byIndexDesc(stashes []stashEntry) []stashEntry {
+	sorted := append([]stashEntry(nil), stashes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].index > sorted[j].index })
+	return sorted
+}
+
+// dropStashes drops several stashes. The ones dropped are returned with the
+// oldest last, so restoring them from the end puts them back in order. On
+// error the stashes dropped so far are still returned. Every ref is checked
+// first, so a stale list drops nothing.
+func dropStashes(stashes []stashEntry) ([]droppedStash, error) {
+	for _, s := range stashes {
+		if _, err := checkStash(s.ref, s.sha); err != nil {
+			return nil, err
+		}
+	}
+	var dropped []droppedStash
+	for _, s := range byIndexDesc(stashes) {
+		d, err := dropStash(s.ref, s.sha)
+		if err != nil {
+			return dropped, fmt.Errorf("dropping %s: %w", s.ref, err)
+		}
+		dropped = append([]droppedStash{d}, dropped...)
+	}
+	return dropped, nil
+}
+
+// exportStashes writes each stash as a patch file into dir, which is
+// created if needed, and returns the directory's path. The patches apply
+// with `git apply`.
+func exportStashes(stashes []stashEntry, dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		top, err := worktreeFile(dir)
+		if err != nil {
+			return "", err
+		}
+		dir = top
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	for _, s := range stashes {
+		patch, err := stashPatch(s.ref)
+		if err != nil {
+			return dir, err
+		}
+		name := fmt.Sprintf("stash-%d", s.index)
+		if slug := slugify(s.message); slug != "" {
+			name += "-" + slug
+		}
+		name += ".patch"
+		text := fmt.Sprintf("%s: %s\n\n%s", s.ref, s.message, patch)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
+
+// slugify turns a stash message into a short file name part.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// storeStash puts a stash commit back on top of the stash list.
+func storeStash(d droppedStash) error {
+	_, err := runGit("stash", "store", "-m", d.subject, d.sha)
+	return err
+}
+
+// rewordRef keeps the stashes a reword drops reachable until they are
+// stored again, in case the reword is interrupted.
+const rewordRef = "refs/stash-explorer/reword"
+
+// rewordStash changes the message of a stash without moving it. The reflog
+// cannot be edited in place, so the stash and every stash above it are
+// dropped and stored again in their original order. On failure it returns
+// the stashes that are no longer in the list, oldest last.
+func rewordStash(e stashEntry, message string) ([]droppedStash, error) {
+	above := make([]droppedStash, e.index+1)
+	for i := range above {
+		d, err := resolveStash(fmt.Sprintf("stash@{%d}", i))
+		if err != nil {
+			return nil, err
+		}
+		above[i] = d
+	}
+	if above[e.index].sha != e.sha {
+		return nil, fmt.Errorf("%s changed, reload and try again", e.ref)
+	}
+	for i := len(above) - 1; i >= 0; i-- {
+		d := above[i]
+		if _, err := runGit("update-ref", "--create-reflog", "-m", d.subject, rewordRef, d.sha); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range above {
+		if _, err := runGit("stash", "drop", "-q", "stash@{0}"); err != nil {
+			lost, restoreErr := restoreStashes(above[:i])
+			if restoreErr != nil {
+				err = fmt.Errorf("%w; %w (also in the reflog of %s)", err, restoreErr, rewordRef)
+			}
+			return lost, err
+		}
+	}
+	if e.branch != "" {
+		message = "On " + e.branch + ": " + message
+	}
+	above[e.index].subject = message
+	lost, err := restoreStashes(above)
+	if err != nil {
+		return lost, fmt.Errorf("%w (also in the reflog of %s)", err, rewordRef)
+	}
+	_, _ = runGit("update-ref", "-d", rewordRef)
+	return nil, nil
+}
+
+// restoreStashes stores dropped stashes again, the first one ending up on
+// top of the stash list. It returns the ones it could not store, in the
+// same order, and an error naming their commits.
+func restoreStashes(stashes []droppedStash) ([]droppedStash, error) {
+	var lost []droppedStash
+	var firstErr error
+	for i := len(stashes) - 1; i >= 0; i-- {
+		if err := storeStash(stashes[i]); err != nil {
+			lost = append([]droppedStash{stashes[i]}, lost...)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr == nil {
+		return nil, nil
+	}
+	shas := make([]string, len(lost))
+	for i, d := range lost {
+		shas[i] = d.sha
+	}
+	return lost, fmt.Errorf("%w; not stored again: %s", firstErr, strings.Join(shas, " "))
+}
+
+// applyPatch applies a patch to the working tree.
+func applyPatch(patch string) error {
+	return gitApply(patch)
+}
+
+// reversePatch undoes a patch in the working tree, and in the index too
+// when it matches the working tree. Otherwise files the patch added are
+// unstaged once the reverse has removed them.
+func reversePatch(patch string) error {
+	if patch == "" {
+		return fmt.Errorf("nothing to reverse")
+	}
+	if gitApply(patch, "-R", "--index") == nil {
+		return nil
+	}
+	if err := gitApply(patch, "-R"); err != nil {
+		return err
+	}
+	return unstageRemoved(patch)
+}
+
+// unstageRemoved drops the index entries of files a patch added that are
+// staged as new but no longer on disk.
+func unstageRemoved(patch string) error {
+	out, err := runApply(patch, "--numstat", "-z")
+	if err != nil {
+		return err
+	}
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	var gone []string
+	for name := range parseNumstat(out) {
+		if _, err := os.Lstat(filepath.Join(root, name)); os.IsNotExist(err) {
+			gone = append(gone, literalPath(name))
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	args := append([]string{"diff", "--cached", "--name-only", "--no-renames", "--diff-filter=A", "-z", "--"}, gone...)
+	if out, err = runGitRaw(args...); err != nil {
+		return err
+	}
+	var added []string
+	for _, name := range splitNUL(out) {
+		added = append(added, literalPath(name))
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	_, err = runGit(append([]string{"rm", "-q", "--cached", "--"}, added...)...)
+	return err
+}
+
+// gitApply runs git apply from the top of the working tree, since it
+// ignores paths outside the current directory.
+func gitApply(patch string, flags ...string) error {
+	_, err := runApply(patch, flags...)
+	return err
+}
+
+// runApply is gitApply returning the output of git apply.
+func runApply(patch string, flags ...string) (string, error) {
+	cdup, err := runGit("rev-parse", "--show-cdup")
+	if err != nil {
+		return "", err
+	}
+	args := append(append([]string{"apply"}, flags...), "-")
+	if cdup != "" {
+		args = append([]string{"-C", cdup}, args...)
+	}
+	return runGitInput(patch, args...)
+}
+
+// stashPatch returns all changes of a stash against its base as a binary
+// patch, untracked files included.
+func stashPatch(ref string) (string, error) {
+	patch, err := runGitRaw("diff", "--binary", ref+"^1", ref)
+	if err != nil {
+		return "", err
+	}
+	if _, err := runGit("rev-parse", "--verify", "--quiet", ref+"^3"); err == nil {
+		from, to, err := sectionRevs(ref, sectionUntracked)
+		if err != nil {
+			return "", err
+		}
+		untracked, err := runGitRaw("diff", "--binary", from, to)
+		if err != nil {
+			return "", err
+		}
+		patch += untracked
+	}
+	return patch, nil
+}
+
+// unapplyStash reverts the changes of a stash, the counterpart of
+// applyStash. Untracked files it saved are removed if they
+// are unchanged.
+func unapplyStash(ref string) error {
+	patch, err := stashPatch(ref)
+	if err != nil {
+		return err
+	}
+	return reversePatch(patch)
+}
+
+// unapplyFile reverts the changes a stash makes to one file, staged and
+// unstaged together.
+func unapplyFile(ref string, file fileEntry) error {
+	from, to := ref+"^1", ref
+	if file.section == sectionUntracked {
+		var err error
+		if from, to, err = sectionRevs(ref, sectionUntracked); err != nil {
+			return err
+		}
+	}
+	args := append([]string{"diff", "--binary", from, to, "--"}, file.paths()...)
+	patch, err := runGitRaw(args...)
+	if err != nil {
+		return err
+	}
+	return reversePatch(patch)
+}
+
+// applyFile restores a single file from a stash into the working tree,
+// taking it from the part of the stash it was listed in. Files the stash
+// deleted are removed, and renamed files lose their old name; neither is
+// done over local changes.
+func applyFile(ref string, file fileEntry) error {
+	if file.status == "D" {
+		_, err := runGit("rm", "-q", "--ignore-unmatch", "--", literalPath(file.name))
+		return err
+	}
+	_, rev, err := sectionRevs(ref, file.section)
+	if err != nil {
+		return err
+	}
+	if _, err := runGit("checkout", rev, "--", literalPath(file.name)); err != nil {
+		return err
+	}
+	if file.oldName != "" {
+		_, err = runGit("rm", "-q", "--ignore-unmatch", "--", literalPath(file.oldName))
+	}
+	return err
+}
+
+// loadConflicts lists the paths left unmerged in the index, e.g. after a
+// stash did not apply cleanly.
+func loadConflicts() ([]fileEntry, error) {
+	out, err := runGitRaw("diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var entries []fileEntry
+	seen := map[string]bool{}
+	for _, name := range splitNUL(out) {
+		if !seen[name] {
+			seen[name] = true
+			entries = append(entries, fileEntry{status: "U", name: name})
+		}
+	}
+	return entries, nil
+}
+
+// conflictStage is one side of a conflicted file as stored in the index.
+type conflictStage struct {
+	text    string
+	present bool // false if the file was deleted on this side
+}
+
+// Index stages of a conflicted file. For a stash apply "ours" is the
+// working tree the stash was applied to and "theirs" is the stash.
+const (
+	stageBase  = 1
+	stageMine  = 2
+	stageStash = 3
+)
+
+// loadConflictStages reads the base, mine and stash versions of a
+// conflicted file.
+func loadConflictStages(name string) ([3]conflictStage, error) {
+	var stages [3]conflictStage
+	for i := range stages {
+		spec := fmt.Sprintf(":%d:%s", i+stageBase, name)
+		if _, err := runGit("cat-file", "-e", spec); err != nil {
+			continue
+		}
+		text, err := runGitRaw("show", spec)
+		if err != nil {
+			return stages, err
+		}
+		stages[i] = conflictStage{text: text, present: true}
+	}
+	return stages, nil
+}
+
+// resolveConflict resolves a conflicted file by taking the stash's or the
+// working tree's version of it, and leaves it unstaged like a clean apply.
+func resolveConflict(name string, takeStash bool) error {
+	side, stage := "--ours", stageMine
+	if takeStash {
+		side, stage = "--theirs", stageStash
+	}
+	if _, err := runGit("cat-file", "-e", fmt.Sprintf(":%d:%s", stage, name)); err != nil {
+		// The chosen side deleted the file
+		if _, err := runGit("rm", "--quiet", "--", literalPath(name)); err != nil {
+			return err
+		}
+	} else if _, err := runGit("checkout", side, "--", literalPath(name)); err != nil {
+		return err
+	}
+	return markResolved(name)
+}
+
+// markResolved clears the conflict state of a file, keeping its contents
+// in the working tree.
+func markResolved(name string) error {
+	_, err := runGit("reset", "--quiet", "--", literalPath(name))
+	return err
+}
+
+// abortApply undoes an apply of a stash that stopped with conflicts. Files
+// the stash touched go back to HEAD in the index and working tree and
+// untracked files it restored are removed; other files are left alone.
+func abortApply(ref string) error {
+	tracked, err := loadSection(ref+"^1", ref)
+	if err != nil {
+		return err
+	}
+	if len(tracked) > 0 {
+		args := []string{"restore", "--source=HEAD", "--staged", "--worktree", "--"}
+		for _, f := range tracked {
+			args = append(args, f.paths()...)
+		}
+		if _, err := runGit(args...); err != nil {
+			return err
+		}
+	}
+	if !hasUntracked(ref) {
+		return nil
+	}
+	// The apply refuses to overwrite untracked files, so these are its own
+	out, err := runGitRaw("ls-tree", "-r", "-z", "--full-tree", "--name-only", ref+"^3")
+	if err != nil {
+		return err
+	}
+	args := []string{"clean", "--quiet", "--force", "--"}
+	for _, name := range splitNUL(out) {
+		args = append(args, literalPath(name))
+	}
+	_, err = runGit(args...)
+	return err
+}
+
+// worktreeFile returns the absolute path of a repository-relative file.
+func worktreeFile(name string) (string, error) {
+	top, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(top, name), nil
+}
+
+// snapshotRef keeps a reflog of the working tree and index as they were
+// before each apply, so an apply can be undone.
+const snapshotRef = "refs/stash-explorer/snapshots"
+
+// snapshot is a saved working tree and index state.
+type snapshot struct {
+	index int
+	ref   string // e.g. refs/stash-explorer/snapshots@{0}
+	sha   string
+	label string // what was about to happen, e.g. "Apply stash@{0}: fix"
+	date  time.Time
+}
+
+// saveSnapshot records the working tree and index like `git stash create`
+// does, without touching either. A clean tree is recorded too, so restoring
+// it undoes whatever was applied on top. Conflicted files are recorded as
+// they are on disk.
+func saveSnapshot(label string) error {
+	// stash create fails without a message when the index has stale stat
+	// data, e.g. after a file was rewritten with the same content, so
+	// refresh it first
+	_, _ = runGit("update-index", "-q", "--refresh")
+
+	out, err := runGitRaw("diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return err
+	}
+	var env []string
+	if unmerged := splitNUL(out); len(unmerged) > 0 {
+		dir, err := os.MkdirTemp("", "stash-explorer-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		// stash create refuses an index with conflicts
+		if env, err = worktreeIndex(dir, unmerged); err != nil {
+			return err
+		}
+	}
+	out, err = runGitEnv(env, "", "stash", "create", label)
+	if err != nil {
+		return err
+	}
+	sha := strings.TrimSpace(out)
+	if sha == "" {
+		// Nothing to stash: build the same shape of commit from HEAD
+		index, err := runGit("commit-tree", "HEAD^{tree}", "-p", "HEAD", "-m", "index: "+label)
+		if err != nil {
+			return err
+		}
+		sha, err = runGit("commit-tree", "HEAD^{tree}", "-p", "HEAD", "-p", index, "-m", label)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = runGit("update-ref", "--create-reflog", "-m", label, snapshotRef, sha)
+	return err
+}
+
+// worktreeIndex copies the index into dir with the given files added from
+// the working tree, or left out if they are not on disk, and returns the
+// environment that points git at the copy.
+func worktreeIndex(dir string, names []string) ([]string, error) {
+	gitDir, err := runGit("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return nil, err
+	}
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(gitDir, "index"))
+	if err != nil {
+		return nil, err
+	}
+	index := filepath.Join(dir, "index")
+	if err := os.WriteFile(index, data, 0o644); err != nil {
+		return nil, err
+	}
+	env := []string{"GIT_INDEX_FILE=" + index}
+	args := append([]string{"-C", root, "update-index", "--add", "--remove", "--"}, names...)
+	if _, err := runGitEnv(env, "", args...); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// loadSnapshots lists the saved snapshots, most recent first.
+func loadSnapshots() ([]snapshot, error) {
+	if _, err := runGit("rev-parse", "--verify", "--quiet", snapshotRef); err != nil {
+		return nil, nil // none saved yet
+	}
+	out, err := runGit("log", "-g", "--format=%gs%x00%H%x00%ct", snapshotRef)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []snapshot
+	for i, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) < 3 {
+			continue
+		}
+		s := snapshot{
+			index: i,
+			ref:   fmt.Sprintf("%s@{%d}", snapshotRef, i),
+			label: fields[0],
+			sha:   fields[1],
+		}
+		if ts, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			s.date = time.Unix(ts, 0)
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+// restoreSnapshot puts the working tree and index back to a snapshot. The
+// current state is saved as a snapshot first, so a restore can be undone
+// too. Untracked files are left alone.
+func restoreSnapshot(s snapshot) error {
+	if err := saveSnapshot("Undo: " + s.label); err != nil {
+		return err
+	}
+	return checkoutSnapshot(s.sha)
+}
+
+// checkoutSnapshot puts the working tree and index back to a snapshot.
+func checkoutSnapshot(sha string) error {
+	if _, err := runGit("read-tree", "--reset", "-u", sha); err != nil {
+		return err
 	}
-	_, err := runGit("checkout", ref, "--", file)
+	// The second parent holds the index
+	_, err := runGit("read-tree", sha+"^2")
 	return err
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestRepo creates a repository with one commit of a.txt in a temporary
+// directory and points git commands at it.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	old := repoDir
+	repoDir = dir
+	t.Cleanup(func() { repoDir = old })
+
+	git(t, "init", "-q", "-b", "main")
+	writeFile(t, "a.txt", "one\n")
+	git(t, "add", ".")
+	git(t, "commit", "-q", "-m", "initial")
+	return dir
+}
+
+// git runs a git command in the test repository and returns its trimmed
+// output.
+func git(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := runGit(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// writeFile writes a file in the test repository, creating directories.
+func writeFile(t *testing.T, name, text string) {
+	t.Helper()
+	path := filepath.Join(repoDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadStashesBaseSubject(t *testing.T) {
+	newTestRepo(t)
+	writeFile(t, "a.txt", "two\n")
+	git(t, "stash", "push", "-q", "-m", "custom message")
+	writeFile(t, "a.txt", "three\n")
+	git(t, "stash", "push", "-q")
+
+	entries, err := loadStashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d stashes, want 2", len(entries))
+	}
+	for _, e := range entries {
+		if e.baseSubject != "initial" {
+			t.Errorf("%s (%q): base subject %q, want %q", e.ref, e.message, e.baseSubject, "initial")
+		}
+	}
+}
+
+func TestCommitFromStashRename(t *testing.T) {
+	newTestRepo(t)
+	git(t, "mv", "a.txt", "b.txt")
+	git(t, "stash", "push", "-q")
+
+	entries, err := loadStashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := commitFromStash(entries[0], "rename a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if status := git(t, "status", "--porcelain"); status != "" {
+		t.Errorf("status after commit:\n%s", status)
+	}
+	if files := git(t, "ls-files"); files != "b.txt" {
+		t.Errorf("index has %q, want %q", files, "b.txt")
+	}
+}
+
+func TestUnapplyLeavesCleanStatus(t *testing.T) {
+	newTestRepo(t)
+	writeFile(t, "a.txt", "two\n")
+	writeFile(t, "staged.txt", "staged\n")
+	git(t, "add", "staged.txt")
+	writeFile(t, "untracked.txt", "untracked\n")
+	git(t, "stash", "push", "-q", "-u")
+
+	entries, err := loadStashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := entries[0].ref
+	if err := applyStash(ref); err != nil {
+		t.Fatal(err)
+	}
+	if err := unapplyStash(ref); err != nil {
+		t.Fatal(err)
+	}
+	if status := git(t, "status", "--porcelain"); status != "" {
+		t.Errorf("status after undoing the stash:\n%s", status)
+	}
+
+	file := fileEntry{name: "staged.txt", status: "A", section: sectionStaged}
+	if err := applyFile(ref, file); err != nil {
+		t.Fatal(err)
+	}
+	if err := unapplyFile(ref, file); err != nil {
+		t.Fatal(err)
+	}
+	if status := git(t, "status", "--porcelain"); status != "" {
+		t.Errorf("status after undoing a file:\n%s", status)
+	}
+}
@@ -15,10 +15,37 @@ var helpBindings = []helpBinding{
 	{"Enter", "Drill into stash / file"},
 	{"Esc", "Go back / quit"},
 	{"q / Ctrl+C", "Quit"},
-	{"/", "Filter list"},
+	{"/", "Filter list (key:value, OR)"},
 	{"j/k / ↑/↓", "Navigate"},
 	{"PgUp/PgDn", "Scroll diff"},
-	{"Ctrl+K", "Apply stash / file"},
+	{"Ctrl+K", "Apply stash / file / selected files"},
+	{"[ / ]", "Previous / next hunk"},
+	{"x", "Mark hunk"},
+	{"Ctrl+A", "Apply marked / current hunks"},
+	{"Ctrl+R", "Reverse-apply stash / file / hunks"},
+	{"s", "Cycle stash sort / side-by-side diff"},
+	{"c", "Toggle syntax highlighting"},
+	{"w", "Toggle changed-word highlighting"},
+	{"Ctrl+B", "Compare against base / HEAD / tree / rev"},
+	{"m", "Mark stash to compare with another"},
+	{"t / m", "Take stash / mine (conflicts)"},
+	{"e", "Edit in $EDITOR (conflicts)"},
+	{"a", "Abort apply (conflicts)"},
+	{"Ctrl+U", "Undo last apply (lists only)"},
+	{"Ctrl+T", "Snapshot history"},
+	{"Ctrl+F", "Search stash contents"},
+	{"Ctrl+G", "Find stashes by path / glob"},
+	{"Space / V", "Select stash / range for bulk ^K ^D ^X"},
+	{"Ctrl+X", "Export stash(es) as patch files"},
+	{"Ctrl+P", "Pop stash"},
+	{"Ctrl+D", "Drop stash"},
+	{"Ctrl+Z", "Undo last pop / drop"},
+	{"Ctrl+N", "New stash from working tree"},
+	{"Ctrl+E", "Reword stash message"},
+	{"Ctrl+W", "Create a branch from stash"},
+	{"Ctrl+O", "Commit stash on current branch"},
+	{"Space / a", "Toggle file / all (file list, new stash)"},
+	{"Tab", "Edit message (new stash)"},
 	{"?", "Toggle this help"},
 }
 
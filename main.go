@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -10,6 +11,11 @@ import (
 
 func main() {
 	flag.StringVar(&repoDir, "C", "", "Run as if git was started in this directory")
+	flag.BoolVar(&noSyntax, "no-syntax", false, "Disable syntax highlighting in diffs")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), cliUsage+"\nFlags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if !isGitRepo() {
@@ -17,6 +23,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args(), os.Stdout); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	p := tea.NewProgram(initialModel(), tea.WithAltScreen(), tea.WithMouseCellMotion())
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
@@ -2,8 +2,14 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -16,14 +22,65 @@ const (
 	stashListView viewState = iota
 	fileListView
 	diffView
+	createView
+	conflictView
+	snapshotView
+	searchView
+	pathView
 )
 
-// applyScope describes what will be applied.
-type applyScope int
+// confirmAction describes what the confirmation dialog will run.
+type confirmAction int
 
 const (
-	applyWholeStash applyScope = iota
+	applyWholeStash confirmAction = iota
 	applySingleFile
+	applyHunks
+	popWholeStash
+	dropWholeStash
+	abortConflicts
+	undoApply
+	branchStash
+	reverseWholeStash
+	reverseSingleFile
+	reverseHunks
+	applySelected
+	dropSelected
+	exportSelected
+	applySelectedFiles
+)
+
+// verbs returns the imperative and past-tense verbs for an action.
+func (a confirmAction) verbs() (string, string) {
+	switch a {
+	case popWholeStash:
+		return "Pop", "Popped"
+	case dropWholeStash, dropSelected:
+		return "Drop", "Dropped"
+	case exportSelected:
+		return "Export", "Exported"
+	case abortConflicts:
+		return "Abort", "Aborted"
+	case undoApply:
+		return "Restore", "Restored"
+	case branchStash:
+		return "Branch", "Branched"
+	case reverseWholeStash, reverseSingleFile, reverseHunks:
+		return "Reverse", "Reversed"
+	}
+	return "Apply", "Applied"
+}
+
+// promptKind tells what the footer text prompt is asking for.
+type promptKind int
+
+const (
+	promptBaseRev promptKind = iota
+	promptSearch
+	promptPath
+	promptReword
+	promptBranch
+	promptExport
 )
 
 // Async messages for loading data.
@@ -38,14 +95,88 @@ type filesLoadedMsg struct {
 }
 
 type diffLoadedMsg struct {
-	diff string
-	file string
-	err  error
+	diff   string
+	tokens [][]syntaxToken
+	file   fileEntry
+	line   int // diff line to scroll to, if not 0
+	err    error
 }
 
-type applyResultMsg struct {
+type pathsFoundMsg struct {
+	hits  []pathHit
+	query string
+	err   error
+}
+
+type searchDoneMsg struct {
+	hits  []searchHit
+	query string
+	err   error
+}
+
+type rebasedMsg struct {
+	base   diffBase
+	files  []fileEntry
+	file   fileEntry // active file, if a diff is open
+	diff   string
+	tokens [][]syntaxToken
+	err    error
+}
+
+type worktreeLoadedMsg struct {
+	files []fileEntry
 	err   error
+}
+
+type stashPushedMsg struct {
 	label string
+	err   error
+}
+
+type applyCheckedMsg struct {
+	sha    string // stash the check ran for
+	states map[string]applyState
+	err    error
+}
+
+type applyResultMsg struct {
+	err       error
+	label     string
+	dropped   []droppedStash // stashes popped or dropped, oldest last
+	ref       string         // stash that failed to apply, if not the confirmed one
+	reload    bool           // stash list changed and must be reloaded
+	conflicts []fileEntry    // files left conflicted by a failed apply
+}
+
+type snapshotsLoadedMsg struct {
+	snapshots []snapshot
+	undo      bool // confirm restoring the latest one instead of listing them
+	err       error
+}
+
+type conflictsLoadedMsg struct {
+	files   []fileEntry
+	label   string
+	aborted bool // the apply was undone rather than resolved
+	err     error
+}
+
+type conflictStagesMsg struct {
+	name   string
+	stages [3]conflictStage
+	err    error
+}
+
+type editorClosedMsg struct {
+	name string
+	path string
+	err  error
+}
+
+type commitEditedMsg struct {
+	stash stashEntry
+	path  string
+	err   error
 }
 
 // model is the top-level Bubble Tea model.
@@ -55,25 +186,86 @@ type model struct {
 	height int
 
 	// Stash list level
-	stashList list.Model
-	stashes   []stashEntry
+	stashList   list.Model
+	stashes     []stashEntry
+	stashSort   stashSort
+	compareBase stashEntry      // stash marked for comparing two stashes, if sha is set
+	selected    map[string]bool // stashes picked for bulk actions, by SHA
+	selectFrom  string          // SHA of the stash last toggled, where ranges start
 
 	// File list level
+	filesReturn viewState // view Esc goes back to
 	fileList    list.Model
 	files       []fileEntry
 	activeStash stashEntry
+	diffBase    diffBase
+
+	// Content search results
+	searchList  list.Model
+	searchQuery string
+
+	// Stashes found by path
+	pathList  list.Model
+	pathQuery string
 
 	// Diff level
+	diffReturn   viewState // view Esc goes back to
+	searchBase   diffBase  // base to go back to when leaving a search hit
 	diffViewport viewport.Model
-	activeFile   string
+	activeFile   fileEntry
 	diffContent  string
+	diffHeader   string
+	diffHunks    []diffHunk
+	hunkCursor   int
+	rowLines     []int
+	diffOpts     diffOptions
+	diffTokens   [][]syntaxToken
+
+	// Dry run of applying a stash, for applyCheckSHA
+	applyChecks   map[string]applyState
+	applyCheckSHA string
+	applyCheckErr error
+	checkingApply bool
+
+	// Create stash level
+	createList  list.Model
+	createInput textinput.Model
+
+	// Snapshot history level
+	snapshotList list.Model
+
+	// Conflict resolution level
+	conflictList   list.Model
+	conflictPanes  viewport.Model
+	conflictTitles string
+	conflictStages [3]conflictStage
+	conflictFile   string    // file shown in the panes
+	conflictRef    string    // stash whose apply stopped with conflicts
+	conflictReturn viewState // view to go back to once resolved
 
 	// Confirmation
-	confirming   bool
-	confirmScope applyScope
-	confirmRef   string
-	confirmFile  string
-	confirmLabel string
+	confirming      bool
+	confirmAction   confirmAction
+	confirmRef      string
+	confirmSHA      string // commit behind confirmRef when the dialog opened
+	confirmFile     fileEntry
+	confirmPatch    string
+	confirmLabel    string
+	confirmSnapshot snapshot
+	confirmBranch   string
+	confirmStashes  []stashEntry // stashes for bulk actions
+	confirmFiles    []fileEntry  // files for applying part of a stash
+	confirmDir      string
+	confirmScroll   int // first line shown of a long stash or file list
+
+	// Text prompt shown in place of the footer
+	prompting   bool
+	promptKind  promptKind
+	promptInput textinput.Model
+	promptStash stashEntry // stash to reword or branch from
+
+	// Stashes removed by pop/drop, most recent last
+	dropped []droppedStash
 
 	// Shared state
 	showHelp bool
@@ -86,12 +278,18 @@ const footerHeight = 1
 
 func initialModel() model {
 	return model{
-		state:   stashListView,
-		loading: true,
+		state:    stashListView,
+		loading:  true,
+		diffOpts: diffOptions{syntax: !noSyntax, wordDiff: true},
 	}
 }
 
 func (m model) Init() tea.Cmd {
+	return loadStashesCmd()
+}
+
+// loadStashesCmd loads the stash list asynchronously.
+func loadStashesCmd() tea.Cmd {
 	return func() tea.Msg {
 		stashes, err := loadStashes()
 		return stashesLoadedMsg{stashes: stashes, err: err}
@@ -132,6 +330,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case diffView:
 				m.diffViewport.Width = w
 				m.diffViewport.Height = h
+				m.refreshDiff()
+			case createView:
+				m.createList.SetSize(w, h-2)
+				m.createInput.Width = max(w-12, 10)
+			case conflictView:
+				m.layoutConflicts()
+			case snapshotView:
+				m.snapshotList.SetSize(w, h)
+			case searchView:
+				m.searchList.SetSize(w, h)
+			case pathView:
+				m.pathList.SetSize(w, h)
 			}
 		}
 		return m, nil
@@ -142,8 +352,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.err = msg.err
 			return m, nil
 		}
+		cursor := m.stashList.Index()
 		m.stashes = msg.stashes
-		m.stashList = newStashList(m.stashes, m.safeWidth(), m.contentHeight())
+		m.stashList = newStashList(m.stashes, m.stashSort, m.safeWidth(), m.contentHeight())
+		m.stashList.Select(min(cursor, max(len(m.stashes)-1, 0)))
+		m.refreshCompareBase()
+		m.refreshSelection()
 		return m, nil
 
 	case filesLoadedMsg:
@@ -154,7 +368,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.files = msg.files
 		m.state = fileListView
-		m.fileList = newFileList(m.files, m.safeWidth(), m.contentHeight())
+		m.fileList = newFileList(m.files, m.diffBase.kind == baseStash, m.safeWidth(), m.contentHeight())
+		m.markApplyChecks()
 		return m, nil
 
 	case diffLoadedMsg:
@@ -164,20 +379,201 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.state = diffView
-		m.activeFile = msg.file
-		m.diffContent = msg.diff
-		m.diffViewport = newDiffViewport(m.diffContent, m.safeWidth(), m.contentHeight())
+		m.showDiff(msg.file, msg.diff, msg.tokens)
+		if msg.line > 0 {
+			m.hunkCursor = max(hunkAt(m.diffHunks, msg.line), 0)
+			m.refreshDiff()
+			m.diffViewport.SetYOffset(max(rowOfLine(m.rowLines, msg.line)-3, 0))
+		}
+		return m, nil
+
+	case pathsFoundMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.state = pathView
+		m.pathList = newPathList(msg.hits, msg.query, m.safeWidth(), m.contentHeight())
+		return m, nil
+
+	case searchDoneMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.state = searchView
+		m.searchList = newSearchList(msg.hits, msg.query, m.safeWidth(), m.contentHeight())
+		return m, nil
+
+	case rebasedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.diffBase = msg.base
+		m.files = msg.files
+		m.fileList = newFileList(m.files, m.diffBase.kind == baseStash, m.safeWidth(), m.contentHeight())
+		m.markApplyChecks()
+		if m.state == diffView {
+			if msg.file.name == "" {
+				m.state = fileListView
+				m.success = fmt.Sprintf("%s does not differ from %s", m.activeFile.label(), m.diffBase.label())
+				return m, nil
+			}
+			m.showDiff(msg.file, msg.diff, msg.tokens)
+		}
+		return m, nil
+
+	case worktreeLoadedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.state = createView
+		m.createList = newChangeList(msg.files, m.safeWidth(), m.contentHeight()-2)
+		m.createInput = newMessageInput(m.safeWidth())
+		return m, nil
+
+	case stashPushedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.state = stashListView
+		m.success = msg.label
+		m.loading = true
+		return m, loadStashesCmd()
+
+	case applyCheckedMsg:
+		if msg.sha != m.applyCheckSHA {
+			return m, nil // a newer check is running
+		}
+		m.checkingApply = false
+		m.applyChecks = msg.states
+		m.applyCheckErr = msg.err
+		m.markApplyChecks()
 		return m, nil
 
 	case applyResultMsg:
 		m.loading = false
+		if len(msg.conflicts) > 0 {
+			m.conflictRef = m.confirmRef
+			if msg.ref != "" {
+				m.conflictRef = msg.ref
+			}
+			return m.showConflicts(msg.conflicts)
+		}
+		m.dropped = append(m.dropped, msg.dropped...)
 		if msg.err != nil {
 			m.err = msg.err
 		} else {
 			m.success = msg.label
 		}
+		cmds := []tea.Cmd{m.recheckApply()}
+		if m.state == snapshotView {
+			// A restore saves the state it replaced as a new snapshot
+			cmds = append(cmds, loadSnapshotsCmd(false))
+		}
+		if msg.reload {
+			m.loading = true
+			cmds = append(cmds, loadStashesCmd())
+		}
+		return m, tea.Batch(cmds...)
+
+	case snapshotsLoadedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		if msg.undo {
+			if len(msg.snapshots) == 0 {
+				m.err = fmt.Errorf("nothing to undo")
+				return m, nil
+			}
+			return m.startSnapshotConfirm(msg.snapshots[0])
+		}
+		cursor := m.snapshotList.Index()
+		m.state = snapshotView
+		m.snapshotList = newSnapshotList(msg.snapshots, m.safeWidth(), m.contentHeight())
+		m.snapshotList.Select(min(cursor, max(len(msg.snapshots)-1, 0)))
+		return m, nil
+
+	case conflictsLoadedMsg:
+		m.loading = false
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.success = msg.label
+		if len(msg.files) > 0 {
+			return m.showConflicts(msg.files)
+		}
+		if !msg.aborted {
+			m.success += " · all resolved"
+		}
+		m.state = m.conflictReturn
+		return m, m.recheckApply()
+
+	case conflictStagesMsg:
+		if msg.name != m.conflictFile {
+			return m, nil // the cursor moved on
+		}
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.conflictStages = msg.stages
+		m.layoutConflicts()
 		return m, nil
 
+	case editorClosedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.loading = true
+		return m, func() tea.Msg {
+			if hasConflictMarkers(msg.path) {
+				return reloadConflicts("Conflict markers left in "+msg.name, false)
+			}
+			if err := markResolved(msg.name); err != nil {
+				return conflictsLoadedMsg{err: err}
+			}
+			return reloadConflicts("Resolved "+msg.name, false)
+		}
+
+	case commitEditedMsg:
+		if msg.err != nil {
+			_ = os.Remove(msg.path)
+			m.err = msg.err
+			return m, nil
+		}
+		message, err := readCommitMessage(msg.path)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		if message == "" {
+			m.err = fmt.Errorf("commit aborted, the message was empty")
+			return m, nil
+		}
+		m.loading = true
+		m.err = nil
+		e := msg.stash
+		return m, func() tea.Msg {
+			commit, err := commitFromStash(e, message)
+			if err != nil {
+				return applyResultMsg{err: err}
+			}
+			return applyResultMsg{label: fmt.Sprintf("Committed %s as %.7s", e.ref, commit)}
+		}
+
 	case tea.KeyMsg:
 		// Clear success message on any key
 		if m.success != "" {
@@ -189,18 +585,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateConfirm(msg)
 		}
 
+		// A focused text input receives every key except Ctrl+C
+		if m.prompting && msg.String() != "ctrl+c" {
+			return m.updatePrompt(msg)
+		}
+		if m.state == createView && m.createInput.Focused() && msg.String() != "ctrl+c" {
+			return m.updateCreate(msg)
+		}
+
 		// Global keys always work
 		switch msg.String() {
 		case "ctrl+c":
 			return m, tea.Quit
 		case "q":
-			if !m.loading {
-				if m.state == stashListView && m.stashList.FilterState() == list.Filtering {
-					break // let list handle it
-				}
-				if m.state == fileListView && m.fileList.FilterState() == list.Filtering {
-					break
-				}
+			if !m.loading && m.filtering() {
+				break // let list handle it
 			}
 			return m, tea.Quit
 		case "?":
@@ -211,6 +610,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 			return m.startConfirm()
+		case "ctrl+r":
+			if m.loading {
+				return m, nil
+			}
+			return m.startReverseConfirm()
+		case "ctrl+u":
+			if m.filtering() {
+				break // clears the filter input
+			}
+			if m.state == diffView {
+				break // scrolls the diff up half a page
+			}
+			if m.loading {
+				return m, nil
+			}
+			m.loading = true
+			m.err = nil
+			return m, loadSnapshotsCmd(true)
 		}
 
 		// Don't forward keys while loading
@@ -238,107 +655,855 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-// startConfirm enters the confirmation dialog for the current context.
+// openStash loads the file list of a stash, compared against the marked
+// stash if there is one, and starts the dry run of applying it.
+func (m model) openStash(entry stashEntry) (tea.Model, tea.Cmd) {
+	m.activeStash = entry
+	switch {
+	case m.compareBase.sha != "" && m.compareBase.sha != entry.sha:
+		m.diffBase = diffBase{kind: baseOtherStash, rev: m.compareBase.sha, name: m.compareBase.ref}
+	case m.diffBase.kind == baseOtherStash:
+		m.diffBase = diffBase{kind: baseStash}
+	}
+	m.loading = true
+	m.err = nil
+	ref := entry.ref
+	base := m.diffBase
+	loadFilesCmd := func() tea.Msg {
+		files, err := loadFiles(ref, base)
+		return filesLoadedMsg{files: files, err: err}
+	}
+	if m.applyCheckSHA == entry.sha {
+		return m, loadFilesCmd
+	}
+	return m, tea.Batch(loadFilesCmd, m.checkApplyCmd(entry))
+}
+
+// filtering reports whether the current view's list filter has focus.
+func (m model) filtering() bool {
+	var l list.Model
+	switch m.state {
+	case stashListView:
+		l = m.stashList
+	case fileListView:
+		l = m.fileList
+	case searchView:
+		l = m.searchList
+	case pathView:
+		l = m.pathList
+	case snapshotView:
+		l = m.snapshotList
+	case conflictView:
+		l = m.conflictList
+	}
+	return l.FilterState() == list.Filtering
+}
+
+// recheckApply reruns the dry run for the open stash after the working tree
+// changed, or forgets stale results if no stash is open.
+func (m *model) recheckApply() tea.Cmd {
+	if m.state == fileListView || m.state == diffView {
+		return m.checkApplyCmd(m.activeStash)
+	}
+	m.applyCheckSHA = ""
+	m.applyChecks = nil
+	return nil
+}
+
+// checkApplyCmd starts a dry run of applying a stash. Results for older
+// checks are ignored when they arrive.
+func (m *model) checkApplyCmd(entry stashEntry) tea.Cmd {
+	m.applyCheckSHA = entry.sha
+	m.applyChecks = nil
+	m.applyCheckErr = nil
+	m.checkingApply = true
+	return func() tea.Msg {
+		states, err := checkApply(entry.sha)
+		return applyCheckedMsg{sha: entry.sha, states: states, err: err}
+	}
+}
+
+// markApplyChecks shows the dry-run results in the file list when they
+// belong to the open stash.
+func (m *model) markApplyChecks() {
+	if m.applyCheckSHA == m.activeStash.sha && m.applyChecks != nil {
+		markApplyStates(&m.fileList, m.applyChecks)
+	}
+}
+
+// startConfirm enters the apply confirmation dialog for the current context.
 func (m model) startConfirm() (tea.Model, tea.Cmd) {
 	switch m.state {
 	case stashListView:
-		item, ok := m.stashList.SelectedItem().(stashItem)
-		if !ok {
-			return m, nil
+		if len(m.selected) > 0 {
+			return m.startBulkConfirm(applySelected, m.selectedStashes())
 		}
-		m.confirming = true
-		m.confirmScope = applyWholeStash
-		m.confirmRef = item.entry.ref
-		m.confirmLabel = fmt.Sprintf("Apply %s: %s", item.entry.ref, item.entry.message)
+		return m.startStashConfirm(applyWholeStash)
 
 	case fileListView:
 		m.confirming = true
-		m.confirmScope = applyWholeStash
 		m.confirmRef = m.activeStash.ref
-		m.confirmLabel = fmt.Sprintf("Apply %s: %s", m.activeStash.ref, m.activeStash.message)
+		if files := selectedFiles(m.fileList); len(files) > 0 {
+			m.confirmAction = applySelectedFiles
+			m.confirmFiles = files
+			m.confirmScroll = 0
+			m.confirmLabel = fmt.Sprintf("%d file(s) from %s", len(files), m.activeStash.ref)
+			break
+		}
+		m.confirmAction = applyWholeStash
+		m.confirmLabel = fmt.Sprintf("%s: %s", m.activeStash.ref, m.activeStash.message)
 
 	case diffView:
+		if err := m.requireStashBase("files"); err != nil {
+			m.err = err
+			return m, nil
+		}
 		m.confirming = true
-		m.confirmScope = applySingleFile
+		m.confirmAction = applySingleFile
 		m.confirmRef = m.activeStash.ref
 		m.confirmFile = m.activeFile
-		m.confirmLabel = fmt.Sprintf("Apply %s to %s", m.activeStash.ref, m.activeFile)
+		m.confirmLabel = fmt.Sprintf("%s from %s", m.activeFile.name, m.activeStash.ref)
 	}
 	return m, nil
 }
 
-func (m model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "y", "Y":
-		m.confirming = false
-		m.loading = true
-		m.err = nil
-		ref := m.confirmRef
-		file := m.confirmFile
-		scope := m.confirmScope
-		label := m.confirmLabel
-		return m, func() tea.Msg {
-			var err error
-			if scope == applySingleFile {
-				err = applyFile(ref, file)
-			} else {
-				err = applyStash(ref)
-			}
-			return applyResultMsg{err: err, label: label}
-		}
-	case "n", "N", "esc":
-		m.confirming = false
+// startHunkConfirm enters the confirmation dialog for applying the marked
+// hunks of the open diff, or the hunk under the cursor if none are marked.
+func (m model) startHunkConfirm() (tea.Model, tea.Cmd) {
+	hunks := m.selectedHunks()
+	if len(hunks) == 0 {
+		return m, nil
+	}
+	if err := m.requireStashBase("hunks"); err != nil {
+		m.err = err
 		return m, nil
 	}
+	m.confirming = true
+	m.confirmAction = applyHunks
+	m.confirmRef = m.activeStash.ref
+	m.confirmPatch = buildPatch(m.diffHeader, hunks)
+	m.confirmLabel = fmt.Sprintf("%d hunk(s) of %s from %s", len(hunks), m.activeFile.name, m.activeStash.ref)
 	return m, nil
 }
 
-func (m model) updateForState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch m.state {
-	case stashListView:
-		return m.updateStashList(msg)
-	case fileListView:
-		return m.updateFileList(msg)
-	case diffView:
-		return m.updateDiffView(msg)
+// requireStashBase refuses to apply or reverse parts of a stash while it is
+// compared against another base, whose diff holds changes the stash never
+// made.
+func (m model) requireStashBase(what string) error {
+	if m.diffBase.kind == baseStash {
+		return nil
 	}
-	return m, nil
+	return fmt.Errorf("%s can only be applied or reversed against the stash's own base; switch back with Ctrl+B", what)
 }
 
-func (m model) updateStashList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "enter":
-		if m.stashList.FilterState() == list.Filtering {
-			break // let the list handle enter to confirm filter
+// selectedHunks returns the marked hunks of the open diff, or the hunk under
+// the cursor if none are marked.
+func (m model) selectedHunks() []diffHunk {
+	if len(m.diffHunks) == 0 {
+		return nil
+	}
+	var hunks []diffHunk
+	for _, h := range m.diffHunks {
+		if h.marked {
+			hunks = append(hunks, h)
 		}
+	}
+	if len(hunks) == 0 {
+		hunks = []diffHunk{m.diffHunks[m.hunkCursor]}
+	}
+	return hunks
+}
+
+// startReverseConfirm enters the confirmation dialog for reverse-applying
+// the selected stash, the selected file or the marked hunks, depending on
+// the view.
+func (m model) startReverseConfirm() (tea.Model, tea.Cmd) {
+	switch m.state {
+	case stashListView:
 		item, ok := m.stashList.SelectedItem().(stashItem)
 		if !ok {
 			return m, nil
 		}
-		m.activeStash = item.entry
-		m.loading = true
-		m.err = nil
-		ref := item.entry.ref
-		return m, func() tea.Msg {
-			files, err := loadFiles(ref)
-			return filesLoadedMsg{files: files, err: err}
+		m.confirmAction = reverseWholeStash
+		m.confirmRef = item.entry.ref
+		m.confirmLabel = fmt.Sprintf("%s: %s", item.entry.ref, item.entry.message)
+
+	case fileListView:
+		item, ok := m.fileList.SelectedItem().(fileItem)
+		if !ok {
+			return m, nil
 		}
-	case "esc":
-		if m.stashList.FilterState() == list.Filtering {
-			break // let list cancel filter
+		m.confirmAction = reverseSingleFile
+		m.confirmRef = m.activeStash.ref
+		m.confirmFile = item.entry
+		m.confirmLabel = fmt.Sprintf("%s from %s", item.entry.name, m.activeStash.ref)
+
+	case diffView:
+		hunks := m.selectedHunks()
+		if len(hunks) == 0 {
+			return m, nil
 		}
-		return m, tea.Quit
+		if err := m.requireStashBase("hunks"); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.confirmAction = reverseHunks
+		m.confirmRef = m.activeStash.ref
+		m.confirmPatch = buildPatch(m.diffHeader, hunks)
+		m.confirmLabel = fmt.Sprintf("%d hunk(s) of %s from %s", len(hunks), m.activeFile.name, m.activeStash.ref)
+
+	default:
+		return m, nil
 	}
+	m.confirming = true
+	return m, nil
+}
 
-	var cmd tea.Cmd
-	m.stashList, cmd = m.stashList.Update(msg)
-	return m, cmd
+// refreshCompareBase re-resolves the compare mark after the stash list was
+// reloaded, dropping it if the marked stash no longer exists.
+func (m *model) refreshCompareBase() {
+	if m.compareBase.sha == "" {
+		return
+	}
+	found := stashEntry{}
+	for _, e := range m.stashes {
+		if e.sha == m.compareBase.sha {
+			found = e
+			break
+		}
+	}
+	m.compareBase = found
+	markCompareBase(&m.stashList, m.compareBase.sha)
 }
 
-func (m model) updateFileList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "enter":
-		if m.fileList.FilterState() == list.Filtering {
+// resortStashes rebuilds the stash list in the current sort order, keeping
+// the filter and the selected stash.
+func (m *model) resortStashes() {
+	selected, _ := m.stashList.SelectedItem().(stashItem)
+	filter := ""
+	if m.stashList.FilterState() == list.FilterApplied {
+		filter = m.stashList.FilterValue()
+	}
+
+	m.stashList = newStashList(m.stashes, m.stashSort, m.safeWidth(), m.contentHeight())
+	if filter != "" {
+		m.stashList.SetFilterText(filter)
+	}
+	for i, it := range m.stashList.VisibleItems() {
+		if it.(stashItem).entry.sha == selected.entry.sha {
+			m.stashList.Select(i)
+			break
+		}
+	}
+	m.refreshCompareBase()
+	m.refreshSelection()
+}
+
+// refreshSelection drops stashes that no longer exist from the bulk
+// selection and marks the rest in the list.
+func (m *model) refreshSelection() {
+	exists := map[string]bool{}
+	for _, e := range m.stashes {
+		exists[e.sha] = true
+	}
+	for sha := range m.selected {
+		if !exists[sha] {
+			delete(m.selected, sha)
+		}
+	}
+	markSelected(&m.stashList, m.selected)
+}
+
+// selectedStashes returns the stashes picked for bulk actions, newest first.
+func (m model) selectedStashes() []stashEntry {
+	var stashes []stashEntry
+	for _, e := range m.stashes {
+		if m.selected[e.sha] {
+			stashes = append(stashes, e)
+		}
+	}
+	return stashes
+}
+
+// toggleSelected picks or unpicks the stash under the cursor. With
+// extend, every visible stash between it and the last one toggled is
+// picked instead.
+func (m model) toggleSelected(extend bool) (tea.Model, tea.Cmd) {
+	item, ok := m.stashList.SelectedItem().(stashItem)
+	if !ok {
+		return m, nil
+	}
+	selected := map[string]bool{}
+	for sha := range m.selected {
+		selected[sha] = true
+	}
+
+	from := -1
+	if extend {
+		for i, it := range m.stashList.VisibleItems() {
+			if it.(stashItem).entry.sha == m.selectFrom {
+				from = i
+			}
+		}
+	}
+	if from == -1 {
+		if selected[item.entry.sha] {
+			delete(selected, item.entry.sha)
+		} else {
+			selected[item.entry.sha] = true
+		}
+	} else {
+		cursor := m.stashList.Index()
+		visible := m.stashList.VisibleItems()
+		for i := min(from, cursor); i <= max(from, cursor); i++ {
+			selected[visible[i].(stashItem).entry.sha] = true
+		}
+	}
+
+	m.selected = selected
+	m.selectFrom = item.entry.sha
+	markSelected(&m.stashList, m.selected)
+	return m, nil
+}
+
+// startBulkConfirm enters the confirmation dialog for an action on several
+// stashes.
+func (m model) startBulkConfirm(action confirmAction, stashes []stashEntry) (tea.Model, tea.Cmd) {
+	m.confirming = true
+	m.confirmAction = action
+	m.confirmStashes = stashes
+	m.confirmScroll = 0
+	m.confirmLabel = fmt.Sprintf("%d stash(es)", len(stashes))
+	return m, nil
+}
+
+// startStashConfirm enters the confirmation dialog for an action on the
+// stash selected in the stash list.
+func (m model) startStashConfirm(action confirmAction) (tea.Model, tea.Cmd) {
+	item, ok := m.stashList.SelectedItem().(stashItem)
+	if !ok {
+		return m, nil
+	}
+	m.confirming = true
+	m.confirmAction = action
+	m.confirmRef = item.entry.ref
+	m.confirmSHA = item.entry.sha
+	m.confirmLabel = fmt.Sprintf("%s: %s", item.entry.ref, item.entry.message)
+	if action != dropWholeStash && m.applyCheckSHA != item.entry.sha {
+		return m, m.checkApplyCmd(item.entry)
+	}
+	return m, nil
+}
+
+func (m model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "down", "pgup", "pgdown":
+		lines := m.confirmListLines()
+		height := m.confirmListHeight()
+		step := 1
+		if msg.String() == "pgup" || msg.String() == "pgdown" {
+			step = height
+		}
+		if msg.String() == "up" || msg.String() == "pgup" {
+			step = -step
+		}
+		m.confirmScroll = max(min(m.confirmScroll+step, len(lines)-height), 0)
+		return m, nil
+	case "k", "K":
+		if m.confirmAction != branchStash {
+			break
+		}
+		return m.branchFromStash(true)
+	case "y", "Y":
+		if m.confirmAction == branchStash {
+			return m.branchFromStash(false)
+		}
+		m.confirming = false
+		m.loading = true
+		m.err = nil
+		ref, sha := m.confirmRef, m.confirmSHA
+		file := m.confirmFile
+		patch := m.confirmPatch
+		snap := m.confirmSnapshot
+		stashes, dir := m.confirmStashes, m.confirmDir
+		files := m.confirmFiles
+		action := m.confirmAction
+		verb, done := action.verbs()
+		label := done + " " + m.confirmLabel
+		snapLabel := verb + " " + m.confirmLabel
+		switch action {
+		case applySelected, dropSelected, exportSelected:
+			m.selected = nil
+			markSelected(&m.stashList, nil)
+		}
+		return m, func() tea.Msg {
+			switch action {
+			case applyWholeStash, applySingleFile, applyHunks, popWholeStash,
+				reverseWholeStash, reverseSingleFile, reverseHunks, applySelected, applySelectedFiles:
+				if err := saveSnapshot(snapLabel); err != nil {
+					return applyResultMsg{err: fmt.Errorf("nothing applied, could not save a snapshot: %w", err)}
+				}
+			case abortConflicts:
+				if err := saveSnapshot(snapLabel); err != nil {
+					return conflictsLoadedMsg{err: fmt.Errorf("nothing aborted, could not save a snapshot: %w", err)}
+				}
+			}
+			switch action {
+			case applySingleFile:
+				return applyResultMsg{err: applyFile(ref, file), label: label}
+			case applySelectedFiles:
+				for i, f := range files {
+					if err := applyFile(ref, f); err != nil {
+						return applyResultMsg{err: fmt.Errorf("%s failed after applying %d file(s): %w", f.name, i, err)}
+					}
+				}
+				return applyResultMsg{label: label}
+			case applyHunks:
+				return applyResultMsg{err: applyPatch(patch), label: label}
+			case applySelected:
+				// Oldest first, as they were stashed
+				for i, s := range byIndexDesc(stashes) {
+					if err := applyStash(s.ref); err != nil {
+						msg := applyFailed(fmt.Errorf("%s failed after applying %d stash(es): %w", s.ref, i, err))
+						msg.ref = s.ref
+						return msg
+					}
+				}
+				return applyResultMsg{label: label}
+			case dropSelected:
+				dropped, err := dropStashes(stashes)
+				return applyResultMsg{err: err, label: label, dropped: dropped, reload: true}
+			case exportSelected:
+				path, err := exportStashes(stashes, dir)
+				return applyResultMsg{err: err, label: label + " to " + path}
+			case reverseWholeStash:
+				return applyResultMsg{err: unapplyStash(ref), label: label}
+			case reverseSingleFile:
+				return applyResultMsg{err: unapplyFile(ref, file), label: label}
+			case reverseHunks:
+				return applyResultMsg{err: reversePatch(patch), label: label}
+			case undoApply:
+				return applyResultMsg{err: restoreSnapshot(snap), label: label}
+			case popWholeStash:
+				d, err := popStash(ref, sha)
+				if err != nil {
+					return applyFailed(err)
+				}
+				return applyResultMsg{label: label, dropped: []droppedStash{d}, reload: true}
+			case dropWholeStash:
+				d, err := dropStash(ref, sha)
+				if err != nil {
+					return applyResultMsg{err: err}
+				}
+				return applyResultMsg{label: label, dropped: []droppedStash{d}, reload: true}
+			case abortConflicts:
+				if err := abortApply(ref); err != nil {
+					return conflictsLoadedMsg{err: err}
+				}
+				return reloadConflicts(label, true)
+			}
+			if err := applyStash(ref); err != nil {
+				return applyFailed(err)
+			}
+			return applyResultMsg{label: label}
+		}
+	case "n", "N", "esc":
+		m.confirming = false
+		return m, nil
+	}
+	return m, nil
+}
+
+// branchFromStash runs the confirmed branch action, keeping or dropping
+// the stash.
+func (m model) branchFromStash(keep bool) (tea.Model, tea.Cmd) {
+	m.confirming = false
+	m.loading = true
+	m.err = nil
+	name, ref := m.confirmBranch, m.confirmRef
+	label := fmt.Sprintf("Created branch %s from %s", name, m.confirmLabel)
+	return m, func() tea.Msg {
+		d, err := branchFromStash(name, ref, keep)
+		if err != nil {
+			return applyFailed(err)
+		}
+		if keep {
+			return applyResultMsg{label: label, reload: true}
+		}
+		return applyResultMsg{label: label, dropped: []droppedStash{d}, reload: true}
+	}
+}
+
+// loadSnapshotsCmd loads the snapshot history, either to list it or to
+// undo the most recent apply.
+func loadSnapshotsCmd(undo bool) tea.Cmd {
+	return func() tea.Msg {
+		snapshots, err := loadSnapshots()
+		return snapshotsLoadedMsg{snapshots: snapshots, undo: undo, err: err}
+	}
+}
+
+// startSnapshotConfirm enters the confirmation dialog for restoring a
+// snapshot.
+func (m model) startSnapshotConfirm(s snapshot) (tea.Model, tea.Cmd) {
+	m.confirming = true
+	m.confirmAction = undoApply
+	m.confirmSnapshot = s
+	m.confirmLabel = "the state before: " + s.label
+	return m, nil
+}
+
+// applyFailed reports a failed stash apply, along with the files it left
+// conflicted, if any.
+func applyFailed(err error) applyResultMsg {
+	conflicts, _ := loadConflicts()
+	return applyResultMsg{err: err, conflicts: conflicts}
+}
+
+// reloadConflicts lists the remaining conflicts after resolving or
+// aborting.
+func reloadConflicts(label string, aborted bool) tea.Msg {
+	files, err := loadConflicts()
+	return conflictsLoadedMsg{files: files, label: label, aborted: aborted, err: err}
+}
+
+// showConflicts switches to the conflict view, keeping the cursor on the
+// same row, and loads the panes for the selected file.
+func (m model) showConflicts(files []fileEntry) (tea.Model, tea.Cmd) {
+	if m.state != conflictView {
+		m.conflictReturn = m.state
+	}
+	cursor := m.conflictList.Index()
+	m.state = conflictView
+	m.conflictList = newConflictList(files, m.safeWidth(), conflictListHeight(len(files), m.contentHeight()))
+	m.conflictList.Select(min(cursor, len(files)-1))
+	m.conflictFile = ""
+	return m, m.loadConflictStagesCmd()
+}
+
+// loadConflictStagesCmd loads the panes for the selected conflicted file
+// unless they are already shown.
+func (m *model) loadConflictStagesCmd() tea.Cmd {
+	item, ok := m.conflictList.SelectedItem().(fileItem)
+	if !ok || item.entry.name == m.conflictFile {
+		return nil
+	}
+	name := item.entry.name
+	m.conflictFile = name
+	m.conflictStages = [3]conflictStage{}
+	m.layoutConflicts()
+	return func() tea.Msg {
+		stages, err := loadConflictStages(name)
+		return conflictStagesMsg{name: name, stages: stages, err: err}
+	}
+}
+
+// layoutConflicts sizes the conflict list and panes and renders the panes.
+func (m *model) layoutConflicts() {
+	w, h := m.safeWidth(), m.contentHeight()
+	listHeight := conflictListHeight(len(m.conflictList.Items()), h)
+	m.conflictList.SetSize(w, listHeight)
+
+	titles, content := renderConflictPanes(m.conflictStages, w)
+	m.conflictTitles = titles
+	yOffset := m.conflictPanes.YOffset
+	m.conflictPanes = newDiffViewport(content, w, max(h-listHeight-1, 1))
+	m.conflictPanes.SetYOffset(yOffset)
+}
+
+// undoDrop stores the most recently popped or dropped stash again.
+func (m model) undoDrop() (tea.Model, tea.Cmd) {
+	if len(m.dropped) == 0 {
+		return m, nil
+	}
+	d := m.dropped[len(m.dropped)-1]
+	m.dropped = m.dropped[:len(m.dropped)-1]
+	m.loading = true
+	m.err = nil
+	return m, func() tea.Msg {
+		if err := storeStash(d); err != nil {
+			return applyResultMsg{err: err, dropped: []droppedStash{d}}
+		}
+		return applyResultMsg{label: "Restored " + d.subject, reload: true}
+	}
+}
+
+// startPrompt shows a text prompt in place of the footer.
+func (m model) startPrompt(kind promptKind, prompt, value string) (tea.Model, tea.Cmd) {
+	m.prompting = true
+	m.promptKind = kind
+	m.promptInput = textinput.New()
+	m.promptInput.Prompt = prompt
+	m.promptInput.Width = max(m.safeWidth()-len(prompt)-2, 10)
+	m.promptInput.SetValue(value)
+	return m, m.promptInput.Focus()
+}
+
+func (m model) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.prompting = false
+		value := strings.TrimSpace(m.promptInput.Value())
+		if value == "" {
+			return m.cancelPrompt()
+		}
+		switch m.promptKind {
+		case promptBaseRev:
+			return m.setBase(diffBase{kind: baseRev, rev: value})
+		case promptPath:
+			m.pathQuery = value
+			m.loading = true
+			m.err = nil
+			stashes := m.stashes
+			return m, func() tea.Msg {
+				hits, err := findStashesByPath(stashes, value)
+				return pathsFoundMsg{hits: hits, query: value, err: err}
+			}
+		case promptReword:
+			e := m.promptStash
+			m.loading = true
+			m.err = nil
+			return m, func() tea.Msg {
+				if lost, err := rewordStash(e, value); err != nil {
+					// Ctrl+Z stores whatever could not be put back
+					return applyResultMsg{err: err, dropped: lost, reload: true}
+				}
+				return applyResultMsg{label: "Reworded " + e.ref, reload: true}
+			}
+		case promptBranch:
+			m.confirming = true
+			m.confirmAction = branchStash
+			m.confirmRef = m.promptStash.ref
+			m.confirmBranch = value
+			m.confirmLabel = fmt.Sprintf("%s: %s", m.promptStash.ref, m.promptStash.message)
+			return m, nil
+		case promptExport:
+			// Show where the patches go, not how the path was typed
+			if !filepath.IsAbs(value) {
+				dir, err := worktreeFile(value)
+				if err != nil {
+					m.err = err
+					return m, nil
+				}
+				value = dir
+			}
+			m.confirmDir = value
+			return m.startBulkConfirm(exportSelected, m.confirmStashes)
+		case promptSearch:
+			m.searchQuery = value
+			m.loading = true
+			m.err = nil
+			stashes := m.stashes
+			return m, func() tea.Msg {
+				hits, err := searchStashes(stashes, compileSearch(value))
+				return searchDoneMsg{hits: hits, query: value, err: err}
+			}
+		}
+		return m, nil
+	case "esc":
+		m.prompting = false
+		return m.cancelPrompt()
+	}
+
+	var cmd tea.Cmd
+	m.promptInput, cmd = m.promptInput.Update(msg)
+	return m, cmd
+}
+
+// cancelPrompt handles a prompt closed without a value. Skipping the
+// revision prompt moves on to the stash base, the next step of the Ctrl+B
+// cycle, so the working tree base is not stuck.
+func (m model) cancelPrompt() (tea.Model, tea.Cmd) {
+	if m.promptKind == promptBaseRev {
+		return m.setBase(diffBase{kind: baseStash})
+	}
+	return m, nil
+}
+
+func (m model) updateForState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.state {
+	case stashListView:
+		return m.updateStashList(msg)
+	case fileListView:
+		return m.updateFileList(msg)
+	case diffView:
+		return m.updateDiffView(msg)
+	case createView:
+		return m.updateCreate(msg)
+	case conflictView:
+		return m.updateConflicts(msg)
+	case snapshotView:
+		return m.updateSnapshots(msg)
+	case searchView:
+		return m.updateSearch(msg)
+	case pathView:
+		return m.updatePaths(msg)
+	}
+	return m, nil
+}
+
+func (m model) updateStashList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if m.stashList.FilterState() == list.Filtering {
+			break // let the list handle enter to confirm filter
+		}
+		item, ok := m.stashList.SelectedItem().(stashItem)
+		if !ok {
+			return m, nil
+		}
+		m.filesReturn = stashListView
+		return m.openStash(item.entry)
+	case "esc":
+		if m.stashList.FilterState() == list.Filtering {
+			break // let list cancel filter
+		}
+		if len(m.selected) > 0 {
+			m.selected = nil
+			markSelected(&m.stashList, nil)
+			return m, nil
+		}
+		return m, tea.Quit
+	case " ", "V":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		return m.toggleSelected(msg.String() == "V")
+	case "ctrl+x":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		stashes := m.selectedStashes()
+		if len(stashes) == 0 {
+			item, ok := m.stashList.SelectedItem().(stashItem)
+			if !ok {
+				return m, nil
+			}
+			stashes = []stashEntry{item.entry}
+		}
+		m.confirmStashes = stashes
+		// Inside the git directory, so the patches don't show up as
+		// untracked files
+		dir := filepath.Join(os.TempDir(), "stash-patches")
+		if gitDir, err := runGit("rev-parse", "--absolute-git-dir"); err == nil {
+			dir = filepath.Join(gitDir, "stash-patches")
+		}
+		return m.startPrompt(promptExport, "Export patches to directory: ", dir)
+	case "ctrl+p":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		return m.startStashConfirm(popWholeStash)
+	case "ctrl+d":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		if len(m.selected) > 0 {
+			return m.startBulkConfirm(dropSelected, m.selectedStashes())
+		}
+		return m.startStashConfirm(dropWholeStash)
+	case "ctrl+z":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		return m.undoDrop()
+	case "ctrl+f":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		return m.startPrompt(promptSearch, "Search stash contents: ", m.searchQuery)
+	case "ctrl+g":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		return m.startPrompt(promptPath, "Stashes touching path or glob: ", m.pathQuery)
+	case "ctrl+t":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		m.loading = true
+		m.err = nil
+		return m, loadSnapshotsCmd(false)
+	case "ctrl+w":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		item, ok := m.stashList.SelectedItem().(stashItem)
+		if !ok {
+			return m, nil
+		}
+		m.promptStash = item.entry
+		return m.startPrompt(promptBranch, "New branch from "+item.entry.ref+": ", "")
+	case "ctrl+o":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		item, ok := m.stashList.SelectedItem().(stashItem)
+		if !ok {
+			return m, nil
+		}
+		path, err := commitMessageFile(item.entry)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		e := item.entry
+		return m, tea.ExecProcess(editorCmd(path), func(err error) tea.Msg {
+			return commitEditedMsg{stash: e, path: path, err: err}
+		})
+	case "ctrl+e":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		item, ok := m.stashList.SelectedItem().(stashItem)
+		if !ok {
+			return m, nil
+		}
+		m.promptStash = item.entry
+		return m.startPrompt(promptReword, "New message for "+item.entry.ref+": ", item.entry.message)
+	case "s":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		m.stashSort = (m.stashSort + 1) % sortModes
+		m.resortStashes()
+		return m, nil
+	case "m":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		item, ok := m.stashList.SelectedItem().(stashItem)
+		if !ok {
+			return m, nil
+		}
+		if m.compareBase.sha == item.entry.sha {
+			m.compareBase = stashEntry{}
+		} else {
+			m.compareBase = item.entry
+		}
+		markCompareBase(&m.stashList, m.compareBase.sha)
+		return m, nil
+	case "ctrl+n":
+		if m.stashList.FilterState() == list.Filtering {
+			break
+		}
+		m.loading = true
+		m.err = nil
+		return m, func() tea.Msg {
+			files, err := loadWorktreeChanges()
+			return worktreeLoadedMsg{files: files, err: err}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.stashList, cmd = m.stashList.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateFileList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if m.fileList.FilterState() == list.Filtering {
 			break
 		}
 		item, ok := m.fileList.SelectedItem().(fileItem)
@@ -347,14 +1512,262 @@ func (m model) updateFileList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		m.loading = true
 		m.err = nil
-		ref := m.activeStash.ref
-		file := item.entry.name
+		m.diffReturn = fileListView
+		ref := m.activeStash.ref
+		file := item.entry
+		base := m.diffBase
+		return m, func() tea.Msg {
+			diff, err := loadDiff(ref, file, base)
+			return diffLoadedMsg{diff: diff, tokens: highlightDiff(diff, file.name), file: file, err: err}
+		}
+	case "esc":
+		if m.fileList.FilterState() == list.Filtering {
+			break
+		}
+		if len(selectedFiles(m.fileList)) > 0 {
+			m.selectAllFiles(false)
+			return m, nil
+		}
+		m.state = m.filesReturn
+		m.err = nil
+		return m, nil
+	case " ":
+		if m.fileList.FilterState() == list.Filtering {
+			break
+		}
+		if err := m.requireStashBase("files"); err != nil {
+			m.err = err
+			return m, nil
+		}
+		if fi, ok := m.fileList.SelectedItem().(fileItem); ok {
+			fi.selected = !fi.selected
+			m.fileList.SetItem(m.fileList.GlobalIndex(), fi)
+		}
+		return m, nil
+	case "a":
+		if m.fileList.FilterState() == list.Filtering {
+			break
+		}
+		if err := m.requireStashBase("files"); err != nil {
+			m.err = err
+			return m, nil
+		}
+		// Select all shown files, or clear them if they are all selected
+		all := true
+		for _, it := range m.fileList.VisibleItems() {
+			if fi, ok := it.(fileItem); ok && !fi.selected {
+				all = false
+			}
+		}
+		m.selectFiles(!all, m.fileList.VisibleItems())
+		return m, nil
+	case "ctrl+b":
+		if m.fileList.FilterState() == list.Filtering {
+			break
+		}
+		return m.cycleBase()
+	}
+
+	var cmd tea.Cmd
+	m.fileList, cmd = m.fileList.Update(msg)
+	return m, cmd
+}
+
+// selectAllFiles picks or unpicks every file in the file list.
+func (m *model) selectAllFiles(selected bool) {
+	m.selectFiles(selected, m.fileList.Items())
+}
+
+// selectFiles picks or unpicks the given items of the file list.
+func (m *model) selectFiles(selected bool, items []list.Item) {
+	picked := map[fileEntry]bool{}
+	for _, it := range items {
+		if fi, ok := it.(fileItem); ok {
+			picked[fi.entry] = true
+		}
+	}
+	for i, it := range m.fileList.Items() {
+		if fi, ok := it.(fileItem); ok && picked[fi.entry] && fi.selected != selected {
+			fi.selected = selected
+			m.fileList.SetItem(i, fi)
+		}
+	}
+}
+
+func (m model) updateDiffView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.state = m.diffReturn
+		if m.diffReturn == searchView {
+			m.diffBase = m.searchBase
+		}
+		m.err = nil
+		return m, nil
+	case "]", "[":
+		if len(m.diffHunks) == 0 {
+			return m, nil
+		}
+		if msg.String() == "]" {
+			m.hunkCursor = min(m.hunkCursor+1, len(m.diffHunks)-1)
+		} else {
+			m.hunkCursor = max(m.hunkCursor-1, 0)
+		}
+		m.refreshDiff()
+		m.diffViewport.SetYOffset(rowOfLine(m.rowLines, m.diffHunks[m.hunkCursor].line))
+		return m, nil
+	case "x":
+		if len(m.diffHunks) == 0 {
+			return m, nil
+		}
+		m.diffHunks[m.hunkCursor].marked = !m.diffHunks[m.hunkCursor].marked
+		m.refreshDiff()
+		return m, nil
+	case "s":
+		m.diffOpts.sideBySide = !m.diffOpts.sideBySide
+		m.refreshDiff()
+		return m, nil
+	case "c":
+		m.diffOpts.syntax = !m.diffOpts.syntax
+		m.refreshDiff()
+		return m, nil
+	case "w":
+		m.diffOpts.wordDiff = !m.diffOpts.wordDiff
+		m.refreshDiff()
+		return m, nil
+	case "ctrl+a":
+		return m.startHunkConfirm()
+	case "ctrl+b":
+		return m.cycleBase()
+	}
+
+	var cmd tea.Cmd
+	m.diffViewport, cmd = m.diffViewport.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateConflicts(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	item, ok := m.conflictList.SelectedItem().(fileItem)
+	switch msg.String() {
+	case "t", "m":
+		if !ok {
+			return m, nil
+		}
+		takeStash := msg.String() == "t"
+		name := item.entry.name
+		side := "mine"
+		if takeStash {
+			side = "stash"
+		}
+		label := fmt.Sprintf("Took %s for %s", side, name)
+		m.loading = true
+		m.err = nil
+		return m, func() tea.Msg {
+			if err := saveSnapshot(fmt.Sprintf("Take %s for %s", side, name)); err != nil {
+				return conflictsLoadedMsg{err: fmt.Errorf("nothing resolved, could not save a snapshot: %w", err)}
+			}
+			if err := resolveConflict(name, takeStash); err != nil {
+				return conflictsLoadedMsg{err: err}
+			}
+			return reloadConflicts(label, false)
+		}
+	case "e":
+		if !ok {
+			return m, nil
+		}
+		name := item.entry.name
+		path, err := worktreeFile(name)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		return m, tea.ExecProcess(editorCmd(path), func(err error) tea.Msg {
+			return editorClosedMsg{name: name, path: path, err: err}
+		})
+	case "a":
+		m.confirming = true
+		m.confirmAction = abortConflicts
+		m.confirmRef = m.conflictRef
+		m.confirmLabel = "applying " + m.conflictRef
+		return m, nil
+	case "pgup":
+		m.conflictPanes.HalfPageUp()
+		return m, nil
+	case "pgdown":
+		m.conflictPanes.HalfPageDown()
+		return m, nil
+	case "esc":
+		m.state = m.conflictReturn
+		m.err = nil
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.conflictList, cmd = m.conflictList.Update(msg)
+	load := m.loadConflictStagesCmd()
+	return m, tea.Batch(cmd, load)
+}
+
+func (m model) updatePaths(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if m.pathList.FilterState() == list.Filtering {
+			break
+		}
+		item, ok := m.pathList.SelectedItem().(pathItem)
+		if !ok {
+			return m, nil
+		}
+		m.filesReturn = pathView
+		return m.openStash(item.hit.stash)
+	case "ctrl+g":
+		if m.pathList.FilterState() == list.Filtering {
+			break
+		}
+		return m.startPrompt(promptPath, "Stashes touching path or glob: ", m.pathQuery)
+	case "esc":
+		if m.pathList.FilterState() == list.Filtering {
+			break
+		}
+		m.state = stashListView
+		m.err = nil
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.pathList, cmd = m.pathList.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if m.searchList.FilterState() == list.Filtering {
+			break
+		}
+		item, ok := m.searchList.SelectedItem().(searchItem)
+		if !ok {
+			return m, nil
+		}
+		hit := item.hit
+		m.activeStash = hit.stash
+		// Hits are found in the stash's own parts, so show them that way
+		// and put the chosen base back afterwards
+		m.searchBase = m.diffBase
+		m.diffBase = diffBase{kind: baseStash}
+		m.diffReturn = searchView
+		m.loading = true
+		m.err = nil
 		return m, func() tea.Msg {
-			diff, err := loadDiff(ref, file)
-			return diffLoadedMsg{diff: diff, file: file, err: err}
+			diff, err := loadDiff(hit.stash.ref, hit.file, diffBase{})
+			return diffLoadedMsg{diff: diff, tokens: highlightDiff(diff, hit.file.name), file: hit.file, line: hit.line, err: err}
 		}
+	case "ctrl+f":
+		if m.searchList.FilterState() == list.Filtering {
+			break
+		}
+		return m.startPrompt(promptSearch, "Search stash contents: ", m.searchQuery)
 	case "esc":
-		if m.fileList.FilterState() == list.Filtering {
+		if m.searchList.FilterState() == list.Filtering {
 			break
 		}
 		m.state = stashListView
@@ -363,25 +1776,181 @@ func (m model) updateFileList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 
 	var cmd tea.Cmd
-	m.fileList, cmd = m.fileList.Update(msg)
+	m.searchList, cmd = m.searchList.Update(msg)
 	return m, cmd
 }
 
-func (m model) updateDiffView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+func (m model) updateSnapshots(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
+	case "enter":
+		if m.snapshotList.FilterState() == list.Filtering {
+			break
+		}
+		if item, ok := m.snapshotList.SelectedItem().(snapshotItem); ok {
+			return m.startSnapshotConfirm(item.entry)
+		}
+		return m, nil
 	case "esc":
-		m.state = fileListView
+		if m.snapshotList.FilterState() == list.Filtering {
+			break
+		}
+		m.state = stashListView
 		m.err = nil
 		return m, nil
 	}
 
 	var cmd tea.Cmd
-	m.diffViewport, cmd = m.diffViewport.Update(msg)
+	m.snapshotList, cmd = m.snapshotList.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateCreate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.createInput.Focused() {
+		switch msg.String() {
+		case "enter":
+			return m.pushSelected()
+		case "esc", "tab":
+			m.createInput.Blur()
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.createInput, cmd = m.createInput.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case " ":
+		idx := m.createList.Index()
+		if ci, ok := m.createList.SelectedItem().(changeItem); ok {
+			ci.selected = !ci.selected
+			m.createList.SetItem(idx, ci)
+		}
+		return m, nil
+	case "a":
+		// Select all, or clear the selection if everything is selected
+		all := len(selectedChanges(m.createList)) == len(m.createList.Items())
+		for i, it := range m.createList.Items() {
+			if ci, ok := it.(changeItem); ok {
+				ci.selected = !all
+				m.createList.SetItem(i, ci)
+			}
+		}
+		return m, nil
+	case "tab":
+		return m, m.createInput.Focus()
+	case "enter":
+		return m.pushSelected()
+	case "esc":
+		m.state = stashListView
+		m.err = nil
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.createList, cmd = m.createList.Update(msg)
 	return m, cmd
 }
 
+// pushSelected stashes the changes selected in the create view.
+func (m model) pushSelected() (tea.Model, tea.Cmd) {
+	selected := selectedChanges(m.createList)
+	if len(selected) == 0 {
+		m.err = fmt.Errorf("no files selected")
+		return m, nil
+	}
+
+	untracked := false
+	for _, e := range selected {
+		if e.status == "?" {
+			untracked = true
+		}
+	}
+	message := strings.TrimSpace(m.createInput.Value())
+
+	m.loading = true
+	m.err = nil
+	return m, func() tea.Msg {
+		err := pushStash(message, selected, untracked)
+		label := fmt.Sprintf("Stashed %d file(s)", len(selected))
+		if message != "" {
+			label += ": " + message
+		}
+		return stashPushedMsg{label: label, err: err}
+	}
+}
+
+// showDiff opens a loaded diff in the diff viewport. The syntax tokens are
+// computed by the load command, since highlighting large diffs is slow.
+func (m *model) showDiff(file fileEntry, diff string, tokens [][]syntaxToken) {
+	m.activeFile = file
+	m.diffContent = diff
+	m.diffHeader, m.diffHunks = parseHunks(diff)
+	m.diffTokens = tokens
+	m.hunkCursor = 0
+	m.diffViewport = newDiffViewport("", m.safeWidth(), m.contentHeight())
+	m.refreshDiff()
+}
+
+// cycleBase switches to the next diff base: stash base, HEAD, working tree,
+// then a revision typed at a prompt.
+func (m model) cycleBase() (tea.Model, tea.Cmd) {
+	switch m.diffBase.kind {
+	case baseStash:
+		return m.setBase(diffBase{kind: baseHead})
+	case baseHead:
+		return m.setBase(diffBase{kind: baseWorktree})
+	case baseWorktree:
+		return m.startPrompt(promptBaseRev, "Compare against: ", "")
+	}
+	return m.setBase(diffBase{kind: baseStash})
+}
+
+// setBase compares the active stash against a new base, reloading the file
+// list and the open diff. The base only changes once both loaded.
+func (m model) setBase(base diffBase) (tea.Model, tea.Cmd) {
+	m.loading = true
+	m.err = nil
+	ref := m.activeStash.ref
+	open := m.activeFile
+	inDiff := m.state == diffView
+	return m, func() tea.Msg {
+		files, err := loadFiles(ref, base)
+		if err != nil || !inDiff {
+			return rebasedMsg{base: base, files: files, err: err}
+		}
+		// A file can be listed in more than one section, so keep the open
+		// one's section if it is still there; otherwise its section changed
+		// with the base. If it does not differ from the new base there is
+		// no diff to show
+		match := -1
+		for i, f := range files {
+			if f.name == open.name && (match < 0 || f.section == open.section) {
+				match = i
+			}
+		}
+		if match < 0 {
+			return rebasedMsg{base: base, files: files}
+		}
+		f := files[match]
+		diff, err := loadDiff(ref, f, base)
+		return rebasedMsg{base: base, files: files, file: f, diff: diff, tokens: highlightDiff(diff, f.name), err: err}
+	}
+}
+
+// refreshDiff re-renders the open diff into the viewport, e.g. after the
+// hunk cursor, render options or terminal width changed.
+func (m *model) refreshDiff() {
+	var content string
+	content, m.rowLines = renderDiff(m.diffContent, m.diffTokens, m.diffHunks, m.hunkCursor, m.diffOpts, m.diffViewport.Width)
+	m.diffViewport.SetContent(content)
+}
+
 func (m model) updateSubview(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
+	if m.prompting {
+		m.promptInput, cmd = m.promptInput.Update(msg)
+		return m, cmd
+	}
 	switch m.state {
 	case stashListView:
 		m.stashList, cmd = m.stashList.Update(msg)
@@ -389,6 +1958,20 @@ func (m model) updateSubview(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.fileList, cmd = m.fileList.Update(msg)
 	case diffView:
 		m.diffViewport, cmd = m.diffViewport.Update(msg)
+	case conflictView:
+		m.conflictList, cmd = m.conflictList.Update(msg)
+	case snapshotView:
+		m.snapshotList, cmd = m.snapshotList.Update(msg)
+	case searchView:
+		m.searchList, cmd = m.searchList.Update(msg)
+	case pathView:
+		m.pathList, cmd = m.pathList.Update(msg)
+	case createView:
+		if m.createInput.Focused() {
+			m.createInput, cmd = m.createInput.Update(msg)
+		} else {
+			m.createList, cmd = m.createList.Update(msg)
+		}
 	}
 	return m, cmd
 }
@@ -418,20 +2001,72 @@ func (m model) View() string {
 		content = m.viewFileList()
 	case diffView:
 		content = m.viewDiff()
+	case createView:
+		content = m.viewCreate()
+	case conflictView:
+		content = m.viewConflicts()
+	case snapshotView:
+		content = m.viewSnapshots()
+	case searchView:
+		content = m.viewSearch()
+	case pathView:
+		content = m.viewPaths()
 	}
 
+	if m.prompting {
+		return content + "\n" + m.promptInput.View()
+	}
 	return content + "\n" + m.viewFooter()
 }
 
 func (m model) viewConfirm() string {
-	title := confirmTitleStyle.Render("Confirm Apply")
-	desc := "\n\n" + m.confirmLabel
-	if m.confirmScope == applySingleFile {
+	verb, _ := m.confirmAction.verbs()
+	title := confirmTitleStyle.Render("Confirm " + verb)
+	desc := "\n\n" + verb + " " + m.confirmLabel
+	switch m.confirmAction {
+	case applySingleFile:
 		desc += "\n\nThis will restore this file from the stash into your working tree."
-	} else {
+	case applyHunks:
+		desc += "\n\nThis will apply only the selected hunks to your working tree, keeping your other edits to the file."
+	case popWholeStash:
+		desc += "\n\nThis will apply all changes from the stash to your working tree and remove it from the stash list."
+	case dropWholeStash:
+		desc += "\n\nThis will remove the stash from the stash list. Press Ctrl+Z afterwards to restore it."
+	case undoApply:
+		desc += "\n\nThis will put your working tree and index back to that state. The current state is saved as a snapshot first; untracked files are left alone."
+	case reverseWholeStash:
+		desc += "\n\nThis will take the stash's changes back out of your working tree, removing untracked files it added if they are unchanged. Nothing is changed if any part does not reverse cleanly."
+	case reverseSingleFile:
+		desc += "\n\nThis will take the stash's changes to this file back out of your working tree. Nothing is changed if they do not reverse cleanly."
+	case reverseHunks:
+		desc += "\n\nThis will take only the selected hunks back out of your working tree, keeping your other edits to the file."
+	case applySelectedFiles:
+		desc += m.confirmList() +
+			"\n\nThis will restore these files from the stash into your working tree, removing the ones it deleted. Your other files are left alone."
+	case applySelected:
+		desc += m.confirmList() +
+			"\n\nThis will apply the stashes to your working tree one after the other, oldest first, stopping at the first that fails. Ctrl+U undoes them all."
+	case dropSelected:
+		desc += m.confirmList() +
+			"\n\nThis will remove the stashes from the stash list. Press Ctrl+Z afterwards to restore them one at a time."
+	case exportSelected:
+		desc += m.confirmList() +
+			"\n\nThis will write each stash as a patch file into " + m.confirmDir + ". The patches apply with git apply."
+	case branchStash:
+		desc = "\n\nCreate branch " + m.confirmBranch + " from " + m.confirmLabel +
+			"\n\nThis will check out a new branch at the commit the stash was made on and apply the stash there. Press y to drop the stash afterwards, like git stash branch, or k to keep it."
+	case abortConflicts:
+		desc += "\n\nThis will put the files the stash touched back to HEAD, staged changes to them included, and remove untracked files it restored. Your other local changes and the stash itself are kept, and Ctrl+U afterwards restores the files as they are now."
+	default:
 		desc += "\n\nThis will apply all changes from the stash to your working tree."
 	}
+	if summary := m.applySummary(); summary != "" {
+		desc += "\n\n" + summary
+	}
 	hint := "\n\n" + confirmHintStyle.Render("y to confirm / n or Esc to cancel")
+	if m.confirmAction == branchStash {
+		hint = "\n\n" + confirmHintStyle.Render("y to branch and drop / k to branch and keep / n or Esc to cancel")
+	}
 
 	box := confirmStyle.
 		Width(min(60, m.width-4)).
@@ -440,23 +2075,146 @@ func (m model) viewConfirm() string {
 	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
 }
 
+// confirmListLines lists the stashes or files of the action being
+// confirmed, one per line.
+func (m model) confirmListLines() []string {
+	var lines []string
+	switch m.confirmAction {
+	case applySelected, dropSelected, exportSelected:
+		for _, s := range m.confirmStashes {
+			lines = append(lines, s.ref+": "+s.message)
+		}
+	case applySelectedFiles:
+		for _, f := range m.confirmFiles {
+			lines = append(lines, f.status+" "+f.label())
+		}
+	}
+	return lines
+}
+
+// confirmListHeight is how many list lines fit in the confirmation dialog
+// next to its text.
+func (m model) confirmListHeight() int {
+	return max(m.height-20, 3)
+}
+
+// confirmList renders the list of the action being confirmed, scrolled
+// with the arrow keys when it does not fit.
+func (m model) confirmList() string {
+	lines := m.confirmListLines()
+	height := m.confirmListHeight()
+	start := min(m.confirmScroll, max(len(lines)-height, 0))
+	end := min(start+height, len(lines))
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, line := range lines[start:end] {
+		b.WriteString("\n  " + truncate(line, 52))
+	}
+	if len(lines) > height {
+		b.WriteString("\n" + confirmHintStyle.Render(fmt.Sprintf("  %d–%d of %d · ↑/↓ to scroll", start+1, end, len(lines))))
+	}
+	return b.String()
+}
+
+// applySummary describes the dry-run result for the action being confirmed.
+func (m model) applySummary() string {
+	switch m.confirmAction {
+	case applyHunks, dropWholeStash, abortConflicts, undoApply, branchStash,
+		reverseWholeStash, reverseSingleFile, reverseHunks,
+		applySelected, dropSelected, exportSelected:
+		return ""
+	}
+	switch {
+	case m.checkingApply:
+		return confirmHintStyle.Render("Checking for conflicts…")
+	case m.applyCheckErr != nil:
+		return errorStyle.Render(fmt.Sprintf("Conflict check failed: %v", m.applyCheckErr))
+	case m.applyChecks == nil:
+		return ""
+	}
+
+	if m.confirmAction == applySelectedFiles {
+		var conflicts int
+		for _, f := range m.confirmFiles {
+			if state := m.applyChecks[f.name]; state == applyConflict || state == applyBlocked {
+				conflicts++
+			}
+		}
+		if conflicts > 0 {
+			return applyConflictStyle.Render(fmt.Sprintf("Your working tree has other changes to %d of these files; they will be overwritten.", conflicts))
+		}
+		return ""
+	}
+
+	if m.confirmAction == applySingleFile {
+		switch m.applyChecks[m.confirmFile.name] {
+		case applyConflict, applyBlocked:
+			return applyConflictStyle.Render("Your working tree has other changes to this file; they will be overwritten.")
+		case applyApplied:
+			return applyAppliedStyle.Render("Your working tree already has this change.")
+		}
+		return ""
+	}
+
+	var blocked, conflicts, applied []string
+	clean := 0
+	for name, state := range m.applyChecks {
+		switch state {
+		case applyBlocked:
+			blocked = append(blocked, name)
+		case applyConflict:
+			conflicts = append(conflicts, name)
+		case applyApplied:
+			applied = append(applied, name)
+		case applyClean:
+			clean++
+		}
+	}
+	sort.Strings(blocked)
+	sort.Strings(conflicts)
+
+	// A few names per line, the rest counted
+	names := func(files []string) string {
+		shown := files[:min(len(files), 5)]
+		more := ""
+		if n := len(files) - len(shown); n > 0 {
+			more = fmt.Sprintf(" and %d more", n)
+		}
+		return strings.Join(shown, ", ") + more
+	}
+
+	var lines []string
+	if len(blocked) > 0 {
+		lines = append(lines, applyConflictStyle.Render(fmt.Sprintf("Local changes to %s stop git from applying: %s",
+			plural(len(blocked), "file"), names(blocked))))
+	}
+	if len(conflicts) > 0 {
+		lines = append(lines, applyConflictStyle.Render(fmt.Sprintf("Conflicts in %s: %s",
+			plural(len(conflicts), "file"), names(conflicts))))
+	}
+	if len(applied) > 0 {
+		lines = append(lines, applyAppliedStyle.Render(plural(len(applied), "file")+" already applied"))
+	}
+	if clean > 0 {
+		lines = append(lines, applyCleanStyle.Render(plural(clean, "file")+" will apply cleanly"))
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (m model) viewFooter() string {
 	var left string
 
 	if m.success != "" {
-		left = successStyle.Render("Applied: " + m.success)
+		left = successStyle.Render(m.success)
 	} else if m.err != nil {
 		left = errorStyle.Render(fmt.Sprintf("Error: %v", m.err))
 	}
 
-	applyLabel := "Apply stash"
-	if m.state == diffView {
-		applyLabel = "Apply file"
+	var right string
+	for _, h := range m.footerHints() {
+		right += footerKeyStyle.Render(h.key) + " " + footerDescStyle.Render(h.desc)
 	}
 
-	right := footerKeyStyle.Render("^K") + " " + footerDescStyle.Render(applyLabel) +
-		footerKeyStyle.Render("?") + " " + footerDescStyle.Render("Help")
-
 	if m.state == diffView {
 		scrollPct := fmt.Sprintf(" %3.f%%", m.diffViewport.ScrollPercent()*100)
 		right = statusBarStyle.Render(scrollPct) + "  " + right
@@ -475,26 +2233,157 @@ func (m model) viewFooter() string {
 	return lipgloss.PlaceHorizontal(m.width, lipgloss.Right, right)
 }
 
+// footerHints returns the key hints shown in the footer for the current view.
+func (m model) footerHints() []helpBinding {
+	var hints []helpBinding
+	switch m.state {
+	case stashListView:
+		hints = append(hints,
+			helpBinding{"^K", "Apply stash"},
+			helpBinding{"^P", "Pop"},
+			helpBinding{"^D", "Drop"},
+		)
+		if len(m.dropped) > 0 {
+			hints = append(hints, helpBinding{"^Z", "Undo drop"})
+		}
+		hints = append(hints,
+			helpBinding{"^N", "New"},
+			helpBinding{"^E", "Reword"},
+			helpBinding{"^W", "Branch"},
+			helpBinding{"^O", "Commit"},
+			helpBinding{"^X", "Export"},
+			helpBinding{"^F", "Search"},
+			helpBinding{"^G", "Find path"},
+			helpBinding{"^T", "Snapshots"},
+			helpBinding{"Space", "Select"},
+			helpBinding{"s", "Sort: " + m.stashSort.String()},
+		)
+		if len(m.selected) > 0 {
+			hints = append(hints, helpBinding{"Esc", fmt.Sprintf("Clear %d selected", len(m.selected))})
+		}
+		if m.compareBase.sha != "" {
+			hints = append(hints, helpBinding{"Enter", "Compare with " + m.compareBase.ref})
+		} else {
+			hints = append(hints, helpBinding{"m", "Compare"})
+		}
+	case fileListView:
+		apply := helpBinding{"^K", "Apply stash"}
+		if n := len(selectedFiles(m.fileList)); n > 0 {
+			apply = helpBinding{"^K", fmt.Sprintf("Apply %d selected", n)}
+		}
+		hints = append(hints,
+			apply,
+			helpBinding{"Space", "Select"},
+			helpBinding{"^B", "Base: " + m.diffBase.label()},
+		)
+	case diffView:
+		hints = append(hints,
+			helpBinding{"^K", "Apply file"},
+			helpBinding{"[ ]", "Hunk"},
+			helpBinding{"x", "Mark"},
+			helpBinding{"^A", "Apply hunks"},
+			helpBinding{"^B", "Base: " + m.diffBase.label()},
+		)
+		if m.diffOpts.sideBySide {
+			hints = append(hints, helpBinding{"s", "Unified"})
+		} else {
+			hints = append(hints, helpBinding{"s", "Side-by-side"})
+		}
+		if m.diffOpts.syntax {
+			hints = append(hints, helpBinding{"c", "Plain"})
+		} else {
+			hints = append(hints, helpBinding{"c", "Syntax"})
+		}
+	case createView:
+		hints = append(hints,
+			helpBinding{"Space", "Toggle"},
+			helpBinding{"Tab", "Message"},
+			helpBinding{"Enter", "Stash"},
+		)
+	case snapshotView:
+		hints = append(hints, helpBinding{"Enter", "Restore"})
+	case searchView:
+		hints = append(hints, helpBinding{"Enter", "Open diff"}, helpBinding{"^F", "New search"})
+	case pathView:
+		hints = append(hints, helpBinding{"Enter", "Open stash"}, helpBinding{"^G", "New path"})
+	case conflictView:
+		hints = append(hints,
+			helpBinding{"t", "Take stash"},
+			helpBinding{"m", "Take mine"},
+			helpBinding{"e", "Edit"},
+			helpBinding{"a", "Abort"},
+		)
+	}
+	return append(hints, helpBinding{"?", "Help"})
+}
+
 func (m model) breadcrumb() string {
 	switch m.state {
 	case stashListView:
 		return breadcrumbStyle.Render("Stashes")
 	case fileListView:
-		stashLabel := fmt.Sprintf("%s: %s", m.activeStash.ref, m.activeStash.message)
+		stashLabel := fmt.Sprintf("%s: %s", m.activeStash.ref, m.activeStash.message) + m.baseSuffix()
 		return breadcrumbStyle.Render("Stashes") +
 			breadcrumbSep.String() +
-			breadcrumbStyle.Render(truncate(stashLabel, 40))
+			breadcrumbStyle.Render(truncate(stashLabel, 40)) +
+			statusBarStyle.Render(truncate(m.stashMeta(), max(m.safeWidth()-55, 10)))
 	case diffView:
-		stashLabel := fmt.Sprintf("%s: %s", m.activeStash.ref, m.activeStash.message)
+		stashLabel := fmt.Sprintf("%s: %s", m.activeStash.ref, m.activeStash.message) + m.baseSuffix()
 		return breadcrumbStyle.Render("Stashes") +
 			breadcrumbSep.String() +
 			breadcrumbStyle.Render(truncate(stashLabel, 30)) +
 			breadcrumbSep.String() +
-			breadcrumbStyle.Render(truncate(m.activeFile, 30))
+			breadcrumbStyle.Render(truncate(m.activeFile.label(), 30)) +
+			statusBarStyle.Render(truncate(m.stashMeta(), max(m.safeWidth()-75, 10)))
+	case createView:
+		return breadcrumbStyle.Render("Stashes") +
+			breadcrumbSep.String() +
+			breadcrumbStyle.Render("New stash")
+	case snapshotView:
+		return breadcrumbStyle.Render("Stashes") +
+			breadcrumbSep.String() +
+			breadcrumbStyle.Render("Snapshots")
+	case searchView:
+		return breadcrumbStyle.Render("Stashes") +
+			breadcrumbSep.String() +
+			breadcrumbStyle.Render("Search")
+	case pathView:
+		return breadcrumbStyle.Render("Stashes") +
+			breadcrumbSep.String() +
+			breadcrumbStyle.Render("By path")
+	case conflictView:
+		return breadcrumbStyle.Render("Stashes") +
+			breadcrumbSep.String() +
+			breadcrumbStyle.Render("Conflicts applying "+m.conflictRef) +
+			breadcrumbSep.String() +
+			breadcrumbStyle.Render(truncate(m.conflictFile, 40))
 	}
 	return ""
 }
 
+// baseSuffix names the diff base in breadcrumbs unless it is the stash base.
+func (m model) baseSuffix() string {
+	if m.diffBase.kind == baseStash {
+		return ""
+	}
+	return " vs " + m.diffBase.label()
+}
+
+// stashMeta describes the age, author and base commit of the active stash.
+func (m model) stashMeta() string {
+	var parts []string
+	if age := relativeAge(m.activeStash.date, time.Now()); age != "" {
+		parts = append(parts, age)
+	}
+	if m.activeStash.author != "" {
+		parts = append(parts, "by "+m.activeStash.author)
+	}
+	if base := m.activeStash.baseLabel(); base != "" {
+		parts = append(parts, "base "+base)
+	}
+	return strings.Join(parts, " · ")
+}
+
 func (m model) viewStashList() string {
 	return m.breadcrumb() + "\n" + m.stashList.View()
 }
@@ -509,9 +2398,30 @@ func (m model) viewDiff() string {
 	return header + "\n" + m.diffViewport.View()
 }
 
+func (m model) viewCreate() string {
+	return m.breadcrumb() + "\n" + m.createList.View() + "\n\n" + m.createInput.View()
+}
+
+func (m model) viewPaths() string {
+	return m.breadcrumb() + "\n" + m.pathList.View()
+}
+
+func (m model) viewSearch() string {
+	return m.breadcrumb() + "\n" + m.searchList.View()
+}
+
+func (m model) viewSnapshots() string {
+	return m.breadcrumb() + "\n" + m.snapshotList.View()
+}
+
+func (m model) viewConflicts() string {
+	return m.breadcrumb() + "\n" + m.conflictList.View() + "\n" + m.conflictTitles + "\n" + m.conflictPanes.View()
+}
+
 func truncate(s string, max int) string {
-	if len(s) <= max {
+	r := []rune(s)
+	if len(r) <= max {
 		return s
 	}
-	return s[:max-1] + "…"
+	return string(r[:max-1]) + "…"
 }
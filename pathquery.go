@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pathHit is a stash that touches files matching a path query.
+type pathHit struct {
+	stash   stashEntry
+	files   []string // matching paths, each listed once
+	added   int
+	removed int
+}
+
+// cleanPathQuery strips the "./" and trailing slash a path query may be
+// typed with.
+func cleanPathQuery(query string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(query, "./"), "/")
+}
+
+// pathQuerySpecs turns a path or glob into git pathspecs. A plain path
+// matches that file or everything below it. In globs `*` and `?` stay
+// within one directory and `**` crosses directories; a glob without a
+// slash is also tried against the file's base name.
+func pathQuerySpecs(query string) []string {
+	query = cleanPathQuery(query)
+	if !strings.ContainsAny(query, "*?[") {
+		return []string{literalPath(query)}
+	}
+	globs := []string{query}
+	if !strings.Contains(query, "/") {
+		globs = append(globs, "**/"+query)
+	}
+	var specs []string
+	for _, g := range globs {
+		// Glob pathspecs don't match the files below a matching directory
+		specs = append(specs, ":(top,glob)"+g, ":(top,glob)"+g+"/**")
+	}
+	return specs
+}
+
+// compilePathQuery turns a path or glob into a matcher for repository
+// paths that agrees with pathQuerySpecs, for filtering stashes whose paths
+// are already loaded.
+func compilePathQuery(query string) func(string) bool {
+	query = cleanPathQuery(query)
+	if !strings.ContainsAny(query, "*?[") {
+		return func(name string) bool {
+			return name == query || strings.HasPrefix(name, query+"/")
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(query[i:], "**/"):
+				b.WriteString("(.*/)?")
+				i += 2
+			case strings.HasPrefix(query[i:], "**"):
+				b.WriteString(".*")
+				i++
+			default:
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := query[i : i+end+1]
+			if strings.HasPrefix(class, "[!") {
+				class = "[^" + class[2:]
+			}
+			b.WriteString(class)
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re, err := regexp.Compile("^" + b.String() + "(/.*)?$")
+	if err != nil {
+		re = regexp.MustCompile("^" + regexp.QuoteMeta(query) + "$")
+	}
+	baseName := !strings.Contains(query, "/")
+	return func(name string) bool {
+		if re.MatchString(name) {
+			return true
+		}
+		return baseName && re.MatchString(name[strings.LastIndex(name, "/")+1:])
+	}
+}
+
+// findStashesByPath lists the stashes that change files matching a path
+// query, with line stats summed over those files. Each stash is diffed
+// against its base as a whole, so a file that is both staged and unstaged
+// counts once.
+func findStashesByPath(stashes []stashEntry, query string) ([]pathHit, error) {
+	specs := pathQuerySpecs(query)
+	var hits []pathHit
+	for _, s := range stashes {
+		revs := [][2]string{{s.ref + "^1", s.ref}}
+		if s.untracked {
+			from, to, err := sectionRevs(s.ref, sectionUntracked)
+			if err != nil {
+				return nil, err
+			}
+			revs = append(revs, [2]string{from, to})
+		}
+
+		hit := pathHit{stash: s}
+		for _, r := range revs {
+			args := append([]string{"diff", "--numstat", "-z", r[0], r[1], "--"}, specs...)
+			out, err := runGitRaw(args...)
+			if err != nil {
+				return nil, err
+			}
+			for name, stat := range parseNumstat(out) {
+				hit.files = append(hit.files, name)
+				hit.added += stat[0]
+				hit.removed += stat[1]
+			}
+		}
+		if len(hit.files) > 0 {
+			sort.Strings(hit.files)
+			hits = append(hits, hit)
+		}
+	}
+	return hits, nil
+}
+
+// pathItem wraps pathHit to implement bubbles list.Item.
+type pathItem struct {
+	hit pathHit
+}
+
+func (i pathItem) FilterValue() string {
+	return i.hit.stash.message + " " + strings.Join(i.hit.files, " ")
+}
+
+// pathDelegate renders a stash with the matching files and their stats.
+type pathDelegate struct{}
+
+func (d pathDelegate) Height() int                             { return 2 }
+func (d pathDelegate) Spacing() int                            { return 0 }
+func (d pathDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+
+func (d pathDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	pi, ok := item.(pathItem)
+	if !ok {
+		return
+	}
+
+	maxWidth := max(m.Width()-4, 20)
+	title := truncate(fmt.Sprintf("%s: %s", pi.hit.stash.ref, pi.hit.stash.message), maxWidth)
+
+	stats := diffAddStyle.Render(fmt.Sprintf("+%d", pi.hit.added)) + " " +
+		diffDelStyle.Render(fmt.Sprintf("-%d", pi.hit.removed))
+	files := plural(len(pi.hit.files), "file") + " · "
+	names := " · " + strings.Join(pi.hit.files, ", ")
+	names = truncate(names, max(maxWidth-len(files)-12, 10))
+
+	cursor := "  "
+	if index == m.Index() {
+		cursor = "> "
+		title = lipglossSelectedTitle(title)
+	} else {
+		title = lipglossNormalTitle(title)
+	}
+
+	fmt.Fprint(w, cursor+title+"\n"+strings.Repeat(" ", 2)+
+		helpDescStyle.Render(files)+stats+helpDescStyle.Render(names))
+}
+
+// newPathList creates a configured list for stashes found by path.
+func newPathList(hits []pathHit, query string, width, height int) list.Model {
+	items := make([]list.Item, len(hits))
+	for i, h := range hits {
+		items[i] = pathItem{hit: h}
+	}
+
+	l := list.New(items, pathDelegate{}, width, height)
+	l.Title = fmt.Sprintf("Stashes touching %q", query)
+	l.SetShowStatusBar(true)
+	l.SetFilteringEnabled(true)
+	l.SetShowHelp(false)
+
+	return l
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxSearchHits stops a content search once this many lines matched.
+const maxSearchHits = 500
+
+// searchHit is a changed line in a stash's diff that matches a content search.
+type searchHit struct {
+	stash  stashEntry
+	file   fileEntry
+	line   int    // index of the line in the file's diff
+	lineNo int    // line number in the old file for removals, new file otherwise
+	text   string // the line with its +/- marker
+}
+
+// compileSearch turns a search query into a regexp. Queries that are not
+// valid regexps are matched literally, and all-lowercase queries ignore case.
+func compileSearch(query string) *regexp.Regexp {
+	re, err := regexp.Compile(query)
+	if err != nil {
+		re = regexp.MustCompile(regexp.QuoteMeta(query))
+	}
+	if !strings.ContainsFunc(query, unicode.IsUpper) {
+		re = regexp.MustCompile("(?i)" + re.String())
+	}
+	return re
+}
+
+// searchStashes looks through the diff of every file in every stash for
+// added or removed lines matching re. Each part of a stash is diffed in one
+// go and split into its files.
+func searchStashes(stashes []stashEntry, re *regexp.Regexp) ([]searchHit, error) {
+	var hits []searchHit
+	for _, s := range stashes {
+		sections := []fileSection{sectionStaged, sectionUnstaged}
+		if s.untracked {
+			sections = append(sections, sectionUntracked)
+		}
+		for _, section := range sections {
+			files, diffs, err := loadSectionDiffs(s.ref, section)
+			if err != nil {
+				return nil, err
+			}
+			for i, f := range files {
+				for _, h := range searchDiff(diffs[i], re) {
+					h.stash, h.file = s, f
+					hits = append(hits, h)
+					if len(hits) == maxSearchHits {
+						return hits, nil
+					}
+				}
+			}
+		}
+	}
+	return hits, nil
+}
+
+// loadSectionDiffs lists the files in one part of a stash along with each
+// file's diff, as loadDiff would return it.
+func loadSectionDiffs(ref string, section fileSection) ([]fileEntry, []string, error) {
+	from, to, err := sectionRevs(ref, section)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := loadSection(from, to)
+	if err != nil || len(files) == 0 {
+		return nil, nil, err
+	}
+	for i := range files {
+		files[i].section = section
+	}
+	out, err := runGitRaw("diff", from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Files come out in the same order as they are listed; each starts
+	// with a "diff --git" line, which no line inside a diff can look like
+	var diffs []string
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	start := 0
+	for i := 1; i <= len(lines); i++ {
+		if i == len(lines) || strings.HasPrefix(lines[i], "diff --git ") {
+			diffs = append(diffs, strings.Join(lines[start:i], "\n"))
+			start = i
+		}
+	}
+	if len(diffs) != len(files) {
+		return nil, nil, fmt.Errorf("%s: expected %d file diffs, got %d", ref, len(files), len(diffs))
+	}
+	return files, diffs, nil
+}
+
+// searchDiff returns the changed lines of a single-file diff matching re.
+func searchDiff(raw string, re *regexp.Regexp) []searchHit {
+	var hits []searchHit
+	var oldNo, newNo int
+	inHunk := false
+	for i, line := range strings.Split(raw, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			oldNo, newNo = parseHunkHeader(line)
+		case !inHunk || line == "":
+		case line[0] == '-':
+			if re.MatchString(line[1:]) {
+				hits = append(hits, searchHit{line: i, lineNo: oldNo, text: line})
+			}
+			oldNo++
+		case line[0] == '+':
+			if re.MatchString(line[1:]) {
+				hits = append(hits, searchHit{line: i, lineNo: newNo, text: line})
+			}
+			newNo++
+		case line[0] == ' ':
+			oldNo++
+			newNo++
+		}
+	}
+	return hits
+}
+
+// searchItem wraps searchHit to implement bubbles list.Item.
+type searchItem struct {
+	hit searchHit
+}
+
+func (i searchItem) FilterValue() string {
+	return i.hit.file.name + " " + i.hit.text
+}
+
+// searchDelegate renders a search hit as its location and the matching line.
+type searchDelegate struct{}
+
+func (d searchDelegate) Height() int                             { return 2 }
+func (d searchDelegate) Spacing() int                            { return 0 }
+func (d searchDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+
+func (d searchDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	si, ok := item.(searchItem)
+	if !ok {
+		return
+	}
+
+	maxWidth := max(m.Width()-4, 20)
+	title := truncate(fmt.Sprintf("%s › %s:%d", si.hit.stash.ref, si.hit.file.name, si.hit.lineNo), maxWidth)
+
+	text := truncate(strings.TrimSpace(si.hit.text[1:]), maxWidth-4)
+	marker := diffAddStyle.Render("+")
+	if si.hit.text[0] == '-' {
+		marker = diffDelStyle.Render("-")
+	}
+
+	cursor := "  "
+	if index == m.Index() {
+		cursor = "> "
+		title = lipglossSelectedTitle(title)
+	} else {
+		title = lipglossNormalTitle(title)
+	}
+
+	fmt.Fprint(w, cursor+title+"\n"+strings.Repeat(" ", 2)+marker+" "+text)
+}
+
+// newSearchList creates a configured list for content search results.
+func newSearchList(hits []searchHit, query string, width, height int) list.Model {
+	items := make([]list.Item, len(hits))
+	for i, h := range hits {
+		items[i] = searchItem{hit: h}
+	}
+
+	l := list.New(items, searchDelegate{}, width, height)
+	l.Title = fmt.Sprintf("Matches for %q", query)
+	if len(hits) == maxSearchHits {
+		l.Title += fmt.Sprintf(" (first %d)", maxSearchHits)
+	}
+	l.SetShowStatusBar(true)
+	l.SetFilteringEnabled(true)
+	l.SetShowHelp(false)
+
+	return l
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearchHitsOpenInTheirSection(t *testing.T) {
+	newTestRepo(t)
+	writeFile(t, "a.txt", "one\nstaged needle\n")
+	git(t, "add", "a.txt")
+	writeFile(t, "new.txt", "untracked needle\n")
+	git(t, "stash", "push", "-q", "-u")
+
+	stashes, err := loadStashes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := searchStashes(stashes, compileSearch("needle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]fileSection{"a.txt": sectionStaged, "new.txt": sectionUntracked}
+	if len(hits) != len(want) {
+		t.Fatalf("got %d hits, want %d", len(hits), len(want))
+	}
+	for _, h := range hits {
+		if h.file.section != want[h.file.name] {
+			t.Errorf("%s: section %v, want %v", h.file.name, h.file.section, want[h.file.name])
+		}
+		diff, err := loadDiff(h.stash.ref, h.file, diffBase{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(diff, "\n")
+		if h.line >= len(lines) || lines[h.line] != h.text {
+			t.Errorf("%s: line %d of the opened diff is not %q", h.file.name, h.line, h.text)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// snapshotItem wraps snapshot to implement bubbles list.Item.
+type snapshotItem struct {
+	entry snapshot
+}
+
+func (i snapshotItem) FilterValue() string {
+	return i.entry.label
+}
+
+// snapshotDelegate renders a snapshot with what it was taken before and
+// when.
+type snapshotDelegate struct{}
+
+func (d snapshotDelegate) Height() int                             { return 2 }
+func (d snapshotDelegate) Spacing() int                            { return 0 }
+func (d snapshotDelegate) Update(_ tea.Msg, _ *list.Model) tea.Cmd { return nil }
+
+func (d snapshotDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	si, ok := item.(snapshotItem)
+	if !ok {
+		return
+	}
+
+	maxWidth := max(m.Width()-4, 20)
+	title := truncate("Before: "+si.entry.label, maxWidth)
+
+	subtitle := "  " + si.entry.sha[:min(7, len(si.entry.sha))]
+	if age := relativeAge(si.entry.date, time.Now()); age != "" {
+		subtitle += " · " + age
+	}
+	subtitle = truncate(subtitle, maxWidth)
+
+	cursor := "  "
+	if index == m.Index() {
+		cursor = "> "
+		title = lipglossSelectedTitle(title)
+		subtitle = lipglossSelectedSubtitle(subtitle)
+	} else {
+		title = lipglossNormalTitle(title)
+		subtitle = lipglossNormalSubtitle(subtitle)
+	}
+
+	fmt.Fprint(w, cursor+title+"\n"+strings.Repeat(" ", 2)+subtitle)
+}
+
+// newSnapshotList creates a configured list for snapshots.
+func newSnapshotList(entries []snapshot, width, height int) list.Model {
+	items := make([]list.Item, len(entries))
+	for i, e := range entries {
+		items[i] = snapshotItem{entry: e}
+	}
+
+	l := list.New(items, snapshotDelegate{}, width, height)
+	l.Title = "Snapshots"
+	l.SetShowStatusBar(true)
+	l.SetFilteringEnabled(true)
+	l.SetShowHelp(false)
+
+	return l
+}
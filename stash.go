@@ -3,7 +3,9 @@ package main
 import (
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
@@ -11,7 +13,9 @@ import (
 
 // stashItem wraps stashEntry to implement bubbles list.Item.
 type stashItem struct {
-	entry stashEntry
+	entry       stashEntry
+	compareBase bool // marked as the base for comparing two stashes
+	selected    bool // picked for a bulk drop, apply or export
 }
 
 func (i stashItem) FilterValue() string {
@@ -42,14 +46,19 @@ func (d stashDelegate) Render(w io.Writer, m list.Model, index int, item list.It
 	}
 
 	title := fmt.Sprintf("%s: %s", ref, msg)
-	if len(title) > maxWidth {
-		title = title[:maxWidth-1] + "…"
+	if si.compareBase {
+		title = "◆ " + title
 	}
+	title = truncate(title, maxWidth)
 
 	subtitle := fmt.Sprintf("  on %s", branch)
-	if len(subtitle) > maxWidth {
-		subtitle = subtitle[:maxWidth-1] + "…"
+	if age := relativeAge(si.entry.date, time.Now()); age != "" {
+		subtitle += " · " + age
 	}
+	if si.entry.author != "" {
+		subtitle += " · " + si.entry.author
+	}
+	subtitle = truncate(subtitle, maxWidth)
 
 	cursor := "  "
 	if index == m.Index() {
@@ -60,6 +69,9 @@ func (d stashDelegate) Render(w io.Writer, m list.Model, index int, item list.It
 		title = lipglossNormalTitle(title)
 		subtitle = lipglossNormalSubtitle(subtitle)
 	}
+	if si.selected {
+		cursor = cursor[:1] + hunkMarkedStyle.Render("●")
+	}
 
 	fmt.Fprint(w, cursor+title+"\n"+strings.Repeat(" ", 2)+subtitle)
 }
@@ -80,17 +92,146 @@ func lipglossNormalSubtitle(s string) string {
 	return statusBarStyle.Render(s)
 }
 
-// newStashList creates a configured list for stash entries.
-func newStashList(entries []stashEntry, width, height int) list.Model {
+// baseLabel describes the commit a stash was made on, e.g. "abc1234 fix login".
+func (e stashEntry) baseLabel() string {
+	if e.base == "" {
+		return ""
+	}
+	return strings.TrimSpace(e.base[:min(7, len(e.base))] + " " + e.baseSubject)
+}
+
+// relativeAge formats how long ago t was, e.g. "3 weeks ago".
+func relativeAge(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d.Minutes()), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d.Hours()), "hour") + " ago"
+	case d < 7*24*time.Hour:
+		return plural(int(d.Hours()/24), "day") + " ago"
+	case d < 30*24*time.Hour:
+		return plural(int(d.Hours()/24/7), "week") + " ago"
+	case d < 365*24*time.Hour:
+		return plural(int(d.Hours()/24/30), "month") + " ago"
+	}
+	return plural(int(d.Hours()/24/365), "year") + " ago"
+}
+
+// plural formats a count with its unit, e.g. "1 file" or "3 files".
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// markCompareBase flags the stash with the given SHA as the compare base
+// and clears the flag on all others.
+func markCompareBase(l *list.Model, sha string) {
+	for i, it := range l.Items() {
+		if si, ok := it.(stashItem); ok {
+			si.compareBase = sha != "" && si.entry.sha == sha
+			l.SetItem(i, si)
+		}
+	}
+}
+
+// markSelected flags the stashes whose SHAs are in selected.
+func markSelected(l *list.Model, selected map[string]bool) {
+	for i, it := range l.Items() {
+		if si, ok := it.(stashItem); ok && si.selected != selected[si.entry.sha] {
+			si.selected = selected[si.entry.sha]
+			l.SetItem(i, si)
+		}
+	}
+}
+
+// stashSort is an order for the stash list.
+type stashSort int
+
+const (
+	sortNewest stashSort = iota // by creation date, then reflog order
+	sortOldest
+	sortBranch
+	sortSize // changed lines, largest first
+	sortFiles
+	sortMessage
+	sortModes
+)
+
+// String names the sort for the list title.
+func (s stashSort) String() string {
+	switch s {
+	case sortOldest:
+		return "oldest"
+	case sortBranch:
+		return "branch"
+	case sortSize:
+		return "size"
+	case sortFiles:
+		return "files"
+	case sortMessage:
+		return "message"
+	}
+	return "newest"
+}
+
+// sortStashes returns the stashes in the given order. Newest and oldest go
+// by creation date, which `git stash store` can take out of reflog order;
+// other ties keep reflog order.
+func sortStashes(entries []stashEntry, by stashSort) []stashEntry {
+	sorted := append([]stashEntry(nil), entries...)
+	var less func(a, b stashEntry) bool
+	switch by {
+	case sortNewest:
+		less = func(a, b stashEntry) bool {
+			if !a.date.Equal(b.date) {
+				return a.date.After(b.date)
+			}
+			return a.index < b.index
+		}
+	case sortOldest:
+		less = func(a, b stashEntry) bool {
+			if !a.date.Equal(b.date) {
+				return a.date.Before(b.date)
+			}
+			return a.index > b.index
+		}
+	case sortBranch:
+		less = func(a, b stashEntry) bool { return a.branch < b.branch }
+	case sortSize:
+		less = func(a, b stashEntry) bool { return a.added+a.removed > b.added+b.removed }
+	case sortFiles:
+		less = func(a, b stashEntry) bool { return len(a.paths) > len(b.paths) }
+	case sortMessage:
+		less = func(a, b stashEntry) bool { return strings.ToLower(a.message) < strings.ToLower(b.message) }
+	default:
+		return sorted
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// newStashList creates a configured list for stash entries in the given
+// order.
+func newStashList(entries []stashEntry, by stashSort, width, height int) list.Model {
+	entries = sortStashes(entries, by)
 	items := make([]list.Item, len(entries))
 	for i, e := range entries {
 		items[i] = stashItem{entry: e}
 	}
 
 	l := list.New(items, stashDelegate{}, width, height)
-	l.Title = "Stashes"
+	l.Title = "Stashes · sorted by " + by.String()
 	l.SetShowStatusBar(true)
 	l.SetFilteringEnabled(true)
+	l.Filter = stashFilter(entries)
 	l.SetShowHelp(false)
 
 	return l
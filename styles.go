@@ -2,6 +2,13 @@ package main
 
 import "github.com/charmbracelet/lipgloss"
 
+// lineStyle groups the styles for one kind of diff line.
+type lineStyle struct {
+	text lipgloss.Style         // plain text without syntax highlighting
+	bg   lipgloss.TerminalColor // background under syntax highlighting
+	emph lipgloss.TerminalColor // background of words changed in the line
+}
+
 var (
 	// Colors
 	subtle    = lipgloss.AdaptiveColor{Light: "#D9DCCF", Dark: "#383838"}
@@ -24,11 +31,51 @@ var (
 	diffHunkStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#7EC8E3")).Bold(true)
 	diffCtxStyle  = lipgloss.NewStyle()
 
+	// Line backgrounds under syntax highlighting, and of changed words
+	addLine = lineStyle{
+		text: diffAddStyle,
+		bg:   lipgloss.AdaptiveColor{Light: "#DDFBE6", Dark: "#1E3A28"},
+		emph: lipgloss.AdaptiveColor{Light: "#ABF2BC", Dark: "#2F6B41"},
+	}
+	delLine = lineStyle{
+		text: diffDelStyle,
+		bg:   lipgloss.AdaptiveColor{Light: "#FDE2E1", Dark: "#3F1D1D"},
+		emph: lipgloss.AdaptiveColor{Light: "#FFB8B8", Dark: "#7A2C2C"},
+	}
+	ctxLine = lineStyle{
+		text: diffCtxStyle,
+		bg:   lipgloss.NoColor{},
+		emph: lipgloss.NoColor{},
+	}
+
+	// Stash sections in the file list
+	sectionStagedStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#73F59F")).Width(9)
+	sectionUnstagedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#E3D97E")).Width(9)
+	sectionUntrackedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).Width(9)
+
+	// Dry-run results of applying a stash
+	applyCleanStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#73F59F"))
+	applyConflictStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#F5735C")).Bold(true)
+	applyAppliedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA"))
+
+	// Side-by-side diff
+	lineNoStyle = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "#AAAAAA", Dark: "#555555"})
+	splitSep    = lipgloss.NewStyle().Foreground(subtle).SetString(" │ ")
+
+	// Conflict panes
+	conflictTitleStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#E3D97E")).Bold(true)
+
+	// Hunk gutter
+	hunkCursorStyle = lipgloss.NewStyle().Foreground(highlight)
+	hunkMarkedStyle = lipgloss.NewStyle().Foreground(special)
+
 	// File status indicators
-	statusAdded    = lipgloss.NewStyle().Foreground(lipgloss.Color("#73F59F")).SetString("+")
-	statusModified = lipgloss.NewStyle().Foreground(lipgloss.Color("#E3D97E")).SetString("~")
-	statusDeleted  = lipgloss.NewStyle().Foreground(lipgloss.Color("#F5735C")).SetString("-")
-	statusRenamed  = lipgloss.NewStyle().Foreground(lipgloss.Color("#7EC8E3")).SetString("R")
+	statusAdded     = lipgloss.NewStyle().Foreground(lipgloss.Color("#73F59F")).SetString("+")
+	statusModified  = lipgloss.NewStyle().Foreground(lipgloss.Color("#E3D97E")).SetString("~")
+	statusDeleted   = lipgloss.NewStyle().Foreground(lipgloss.Color("#F5735C")).SetString("-")
+	statusRenamed   = lipgloss.NewStyle().Foreground(lipgloss.Color("#7EC8E3")).SetString("R")
+	statusUntracked = lipgloss.NewStyle().Foreground(lipgloss.Color("#AAAAAA")).SetString("?")
+	statusConflict  = lipgloss.NewStyle().Foreground(lipgloss.Color("#F5735C")).Bold(true).SetString("!")
 
 	// Help overlay
 	helpStyle = lipgloss.NewStyle().
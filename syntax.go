@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// noSyntax turns syntax highlighting off by default. Set via -no-syntax flag.
+var noSyntax bool
+
+// syntaxToken is a run of code with a single syntax style.
+type syntaxToken struct {
+	text  string
+	style lipgloss.Style
+}
+
+var (
+	syntaxStyleOnce sync.Once
+	syntaxStyle     *chroma.Style
+	tokenStyles     = map[chroma.TokenType]lipgloss.Style{}
+	tokenStylesMu   sync.Mutex
+)
+
+// tokenStyle converts the chroma style for a token type to a lipgloss style.
+func tokenStyle(t chroma.TokenType) lipgloss.Style {
+	syntaxStyleOnce.Do(func() {
+		name := "github"
+		if lipgloss.HasDarkBackground() {
+			name = "monokai"
+		}
+		syntaxStyle = styles.Get(name)
+	})
+
+	tokenStylesMu.Lock()
+	defer tokenStylesMu.Unlock()
+	if s, ok := tokenStyles[t]; ok {
+		return s
+	}
+	entry := syntaxStyle.Get(t)
+	s := lipgloss.NewStyle()
+	if entry.Colour.IsSet() {
+		s = s.Foreground(lipgloss.Color(entry.Colour.String()))
+	}
+	if entry.Bold == chroma.Yes {
+		s = s.Bold(true)
+	}
+	if entry.Italic == chroma.Yes {
+		s = s.Italic(true)
+	}
+	tokenStyles[t] = s
+	return s
+}
+
+// highlightDiff tokenizes the code in a single-file diff with the lexer
+// matching the file name. It returns the tokens for each diff line, or nil
+// if the language is unknown. The old and new side of every hunk are lexed
+// as a whole so multi-line strings and comments keep their colors.
+func highlightDiff(raw, filename string) [][]syntaxToken {
+	lexer := lexers.Match(filename)
+	if lexer == nil {
+		return nil
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	lines := strings.Split(raw, "\n")
+	tokens := make([][]syntaxToken, len(lines))
+
+	// Line indexes and code of each side of the current hunk
+	var oldIdx, newIdx []int
+	var oldCode, newCode []string
+	flush := func() {
+		assignTokens(tokens, oldIdx, lexLines(lexer, oldCode))
+		assignTokens(tokens, newIdx, lexLines(lexer, newCode))
+		oldIdx, newIdx, oldCode, newCode = nil, nil, nil, nil
+	}
+
+	inHunk := false
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			flush()
+			inHunk = true
+		case !inHunk || line == "":
+		case line[0] == '-':
+			oldIdx = append(oldIdx, i)
+			oldCode = append(oldCode, line[1:])
+		case line[0] == '+':
+			newIdx = append(newIdx, i)
+			newCode = append(newCode, line[1:])
+		case line[0] == ' ':
+			// Context lines are lexed on both sides but colored from the new one
+			oldIdx = append(oldIdx, -1)
+			oldCode = append(oldCode, line[1:])
+			newIdx = append(newIdx, i)
+			newCode = append(newCode, line[1:])
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// lexLines tokenizes lines of code and returns the tokens for each line.
+func lexLines(lexer chroma.Lexer, code []string) [][]syntaxToken {
+	if len(code) == 0 {
+		return nil
+	}
+	it, err := lexer.Tokenise(nil, strings.Join(code, "\n")+"\n")
+	if err != nil {
+		return nil
+	}
+
+	result := make([][]syntaxToken, len(code))
+	line := 0
+	for tok := it(); tok != chroma.EOF; tok = it() {
+		// Tokens may span lines; split them at newlines
+		parts := strings.Split(tok.Value, "\n")
+		for j, part := range parts {
+			if j > 0 {
+				line++
+			}
+			if part != "" && line < len(result) {
+				result[line] = append(result[line], syntaxToken{text: part, style: tokenStyle(tok.Type)})
+			}
+		}
+	}
+	return result
+}
+
+// assignTokens stores per-line tokens at the given diff line indexes,
+// skipping indexes of -1.
+func assignTokens(tokens [][]syntaxToken, idx []int, lexed [][]syntaxToken) {
+	for j, i := range idx {
+		if i >= 0 && j < len(lexed) {
+			tokens[i] = lexed[j]
+		}
+	}
+}
+
+// renderTokens renders highlighted code, optionally on a background color.
+func renderTokens(tokens []syntaxToken, bg lipgloss.TerminalColor) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString(t.style.Background(bg).Render(t.text))
+	}
+	return b.String()
+}
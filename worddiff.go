@@ -0,0 +1,135 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// span is a byte range [start, end) within a line.
+type span struct {
+	start, end int
+}
+
+// wordRe splits a line into words, runs of whitespace and single symbols.
+var wordRe = regexp.MustCompile(`[\p{L}\p{N}_]+|\s+|.`)
+
+// maxWordDiffCells bounds the LCS table so very long lines stay cheap.
+const maxWordDiffCells = 40000
+
+// wordDiffSpans pairs each run of removed lines in a diff with the added
+// lines that follow it and returns, per diff line, the spans of words that
+// differ from its partner. Unpaired lines and pairs with too little in
+// common get no spans.
+func wordDiffSpans(raw string) [][]span {
+	lines := strings.Split(raw, "\n")
+	spans := make([][]span, len(lines))
+
+	inHunk := false
+	for i := 0; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "@@") {
+			inHunk = true
+		}
+		if !inHunk || !strings.HasPrefix(lines[i], "-") {
+			continue
+		}
+		var dels, adds []int
+		for i < len(lines) && strings.HasPrefix(lines[i], "-") {
+			dels = append(dels, i)
+			i++
+		}
+		for i < len(lines) && strings.HasPrefix(lines[i], "+") {
+			adds = append(adds, i)
+			i++
+		}
+		i--
+
+		for j := 0; j < min(len(dels), len(adds)); j++ {
+			d, a := dels[j], adds[j]
+			spans[d], spans[a] = wordDiff(lines[d][1:], lines[a][1:])
+		}
+	}
+	return spans
+}
+
+// wordDiff returns the spans of a and b not shared by the longest common
+// sequence of words between them.
+func wordDiff(a, b string) ([]span, []span) {
+	wa := wordRe.FindAllStringIndex(a, -1)
+	wb := wordRe.FindAllStringIndex(b, -1)
+	if len(wa)*len(wb) > maxWordDiffCells {
+		return nil, nil
+	}
+
+	// lcs[i][j] is the LCS length of wa[i:] and wb[j:]
+	lcs := make([][]int, len(wa)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(wb)+1)
+	}
+	for i := len(wa) - 1; i >= 0; i-- {
+		for j := len(wb) - 1; j >= 0; j-- {
+			if a[wa[i][0]:wa[i][1]] == b[wb[j][0]:wb[j][1]] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Emphasizing nearly everything is just noise
+	if common := lcs[0][0]; common*3 < max(len(wa), len(wb)) {
+		return nil, nil
+	}
+
+	var sa, sb []span
+	i, j := 0, 0
+	for i < len(wa) || j < len(wb) {
+		switch {
+		case i < len(wa) && j < len(wb) && a[wa[i][0]:wa[i][1]] == b[wb[j][0]:wb[j][1]]:
+			i++
+			j++
+		case j == len(wb) || (i < len(wa) && lcs[i+1][j] >= lcs[i][j+1]):
+			sa = appendSpan(sa, wa[i])
+			i++
+		default:
+			sb = appendSpan(sb, wb[j])
+			j++
+		}
+	}
+	return sa, sb
+}
+
+// appendSpan adds a word's range, merging it with an adjacent previous span.
+func appendSpan(spans []span, word []int) []span {
+	if n := len(spans); n > 0 && spans[n-1].end == word[0] {
+		spans[n-1].end = word[1]
+		return spans
+	}
+	return append(spans, span{word[0], word[1]})
+}
+
+// splitAtSpans cuts syntax tokens at span boundaries and reports, for each
+// resulting token, whether it lies inside a span.
+func splitAtSpans(tokens []syntaxToken, spans []span) ([]syntaxToken, []bool) {
+	var out []syntaxToken
+	var inside []bool
+	pos := 0
+	for _, t := range tokens {
+		text := t.text
+		for text != "" {
+			n, in := len(text), false
+			for _, s := range spans {
+				switch {
+				case pos >= s.start && pos < s.end:
+					n, in = min(n, s.end-pos), true
+				case pos < s.start:
+					n = min(n, s.start-pos)
+				}
+			}
+			out = append(out, syntaxToken{text: text[:n], style: t.style})
+			inside = append(inside, in)
+			pos += n
+			text = text[n:]
+		}
+	}
+	return out, inside
+}